@@ -0,0 +1,448 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/liviu-moraru/snippetbox/internal/models"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envelope wraps every JSON response in a top-level object, like
+// {"snippet": {...}} or {"error": {...}}.
+type envelope map[string]any
+
+// apiSnippet is the JSON representation of a models.Snippet. The expiry date
+// is null for snippets which never expire.
+type apiSnippet struct {
+	ID         int        `json:"id"`
+	Slug       string     `json:"slug"`
+	Author     string     `json:"author"`
+	Title      string     `json:"title"`
+	Content    string     `json:"content"`
+	Language   string     `json:"language"`
+	Format     string     `json:"format"`
+	Visibility string     `json:"visibility"`
+	Created    time.Time  `json:"created"`
+	Expires    *time.Time `json:"expires"`
+	ParentID   int        `json:"parent_id,omitempty"`
+	Forks      int        `json:"forks"`
+	Tags       []string   `json:"tags"`
+
+	BurnAfterReading bool `json:"burn_after_reading"`
+	Encrypted        bool `json:"encrypted"`
+
+	// The extra files are only included for a single snippet, not in
+	// listings.
+	Filename string           `json:"filename,omitempty"`
+	Files    []apiSnippetFile `json:"files,omitempty"`
+}
+
+// apiSnippetFile is the JSON representation of an extra file of a snippet.
+type apiSnippetFile struct {
+	Filename string `json:"filename"`
+	Language string `json:"language"`
+	Content  string `json:"content"`
+}
+
+func newAPISnippet(s *models.Snippet) apiSnippet {
+	var expires *time.Time
+	if s.Expires.Valid {
+		expires = &s.Expires.Time
+	}
+
+	snippet := apiSnippet{
+		ID:         s.ID,
+		Slug:       s.Slug,
+		Author:     s.Author,
+		Title:      s.Title.String,
+		Content:    s.Content,
+		Language:   s.Language,
+		Format:     s.Format,
+		Visibility: s.Visibility,
+		Created:    s.Created,
+		Expires:    expires,
+		ParentID:   int(s.ParentID.Int64),
+		Forks:      s.Forks,
+		Tags:       s.Tags,
+		Filename:   s.Filename,
+
+		BurnAfterReading: s.BurnAfterReading,
+		Encrypted:        s.Encrypted,
+	}
+
+	for _, f := range s.Files {
+		snippet.Files = append(snippet.Files, apiSnippetFile{Filename: f.Filename, Language: f.Language, Content: f.Content})
+	}
+
+	return snippet
+}
+
+// apiError is the body of the "error" envelope. Fields is only set when the
+// request failed validation, and mirrors validator.Validator.FieldErrors.
+type apiError struct {
+	Status  int               `json:"status"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// The writeJSON helper encodes data as JSON and sends it with the given status
+// code and any additional headers.
+func (app *Application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) {
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	js = append(js, '\n')
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+}
+
+// The readJSON helper decodes a request body into dst. It rejects bodies over
+// 1MB, unknown fields and anything after the first JSON value, and turns the
+// decoder errors into messages that are safe to send back to the client.
+func (app *Application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains badly-formed JSON")
+		case errors.As(err, &unmarshalTypeError):
+			return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			return fmt.Errorf("body contains unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+		case err.Error() == "http: request body too large":
+			return errors.New("body must not be larger than 1MB")
+		default:
+			return err
+		}
+	}
+
+	err = dec.Decode(&struct{}{})
+	if err != io.EOF {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
+// The apiErrorResponse helper sends an error envelope with the given status.
+func (app *Application) apiErrorResponse(w http.ResponseWriter, status int, message string) {
+	app.writeJSON(w, status, envelope{"error": apiError{Status: status, Message: message}}, nil)
+}
+
+// The apiServerError helper is the JSON counterpart of serverError: it logs
+// the error and stack trace, then sends a generic 500 error envelope.
+func (app *Application) apiServerError(w http.ResponseWriter, err error) {
+	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
+	app.ErrorLog.Output(2, trace)
+	app.apiErrorResponse(w, http.StatusInternalServerError, "the server encountered a problem and could not process your request")
+}
+
+func (app *Application) apiNotFound(w http.ResponseWriter) {
+	app.apiErrorResponse(w, http.StatusNotFound, "the requested resource could not be found")
+}
+
+// The apiValidationFailed helper reports the field errors collected by a
+// validator.Validator, using a 422 status like the HTML forms do.
+func (app *Application) apiValidationFailed(w http.ResponseWriter, fieldErrors map[string]string) {
+	status := http.StatusUnprocessableEntity
+	app.writeJSON(w, status, envelope{"error": apiError{
+		Status:  status,
+		Message: "the request failed validation",
+		Fields:  fieldErrors,
+	}}, nil)
+}
+
+// The apiSnippet helper fetches the snippet named by the :id parameter,
+// sending a 404 error envelope if it doesn't exist or the user isn't allowed
+// to see it. Like on the site, burn-after-reading snippets are hidden from
+// everyone but their owner: they can only be read with apiSnippetBurn.
+func (app *Application) apiSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	snippet, ok := app.apiVisibleSnippet(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if snippet.BurnAfterReading && snippet.UserID != app.authenticatedUserID(r) {
+		app.apiNotFound(w)
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// The apiVisibleSnippet helper fetches the snippet named by the :id parameter,
+// including burn-after-reading snippets.
+func (app *Application) apiVisibleSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.apiNotFound(w)
+		return nil, false
+	}
+
+	snippet, err := app.Snippets.GetVisible(id, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w)
+		} else {
+			app.apiServerError(w, err)
+		}
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// The apiOwnedSnippet helper works like apiSnippet, but also checks that the
+// snippet belongs to the authenticated user.
+func (app *Application) apiOwnedSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	snippet, ok := app.apiSnippet(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if snippet.UserID != app.authenticatedUser(r).ID {
+		app.apiErrorResponse(w, http.StatusForbidden, "you do not have permission to change this resource")
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+func (app *Application) apiSnippetList(w http.ResponseWriter, r *http.Request) {
+	// The listing accepts the same query string parameters as /snippets.
+	form := newSnippetListForm()
+
+	err := app.FormDecoder.Decode(&form, r.URL.Query())
+	if err != nil {
+		app.apiErrorResponse(w, http.StatusBadRequest, "the query string contains invalid values")
+		return
+	}
+
+	filter := form.filter()
+
+	if !form.Valid() {
+		app.apiValidationFailed(w, form.FieldErrors)
+		return
+	}
+
+	snippets, metadata, err := app.Snippets.List(filter)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	// Always send an array, even if there are no snippets.
+	list := make([]apiSnippet, 0, len(snippets))
+	for _, s := range snippets {
+		list = append(list, newAPISnippet(s))
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"metadata": metadata, "snippets": list}, nil)
+}
+
+// The apiUnlocked helper checks the password of a protected snippet, which
+// API clients send in a header. The failed attempts are limited just like on
+// the password prompt. If the snippet stays locked an error envelope is sent
+// and false is returned.
+func (app *Application) apiUnlocked(w http.ResponseWriter, r *http.Request, snippet *models.Snippet) bool {
+	if app.isUnlocked(r, snippet) {
+		return true
+	}
+
+	password := r.Header.Get("X-Snippet-Password")
+	if password == "" {
+		app.apiErrorResponse(w, http.StatusForbidden, "this snippet is protected, send its password in the X-Snippet-Password header")
+		return false
+	}
+
+	key := passwordAttemptKey(r, snippet.ID)
+	if !app.PasswordAttempts.allow(key) {
+		app.apiErrorResponse(w, http.StatusTooManyRequests, "too many incorrect passwords, please try again later")
+		return false
+	}
+
+	err := snippet.CheckPassword(password)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.apiErrorResponse(w, http.StatusForbidden, "the snippet password is incorrect")
+		} else {
+			app.PasswordAttempts.release(key)
+			app.apiServerError(w, err)
+		}
+		return false
+	}
+
+	// The password was correct, so the attempt doesn't count as a failure.
+	app.PasswordAttempts.release(key)
+
+	return true
+}
+
+func (app *Application) apiSnippetGet(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.apiSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.apiUnlocked(w, r, snippet) {
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"snippet": newAPISnippet(snippet)}, nil)
+}
+
+// The apiSnippetBurn handler reads a burn-after-reading snippet, deleting it
+// at the same time. GET requests must be safe to retry and prefetch, so
+// reading such a snippet takes this explicit POST request. Owners read their
+// snippets with GET instead, so for them (and for other snippets) it's 404.
+func (app *Application) apiSnippetBurn(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.apiVisibleSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	if !snippet.BurnAfterReading || snippet.UserID == app.authenticatedUserID(r) {
+		app.apiNotFound(w)
+		return
+	}
+
+	if !app.apiUnlocked(w, r, snippet) {
+		return
+	}
+
+	// If someone else burned the snippet in the meantime, Burn() returns
+	// ErrNoRecord and this reader gets a 404 like any later one.
+	snippet, err := app.Snippets.Burn(snippet.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w)
+		} else {
+			app.apiServerError(w, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"snippet": newAPISnippet(snippet)}, nil)
+}
+
+func (app *Application) apiSnippetCreate(w http.ResponseWriter, r *http.Request) {
+	// The language, format and visibility are optional.
+	form := snippetCreateForm{Language: "plaintext", Format: models.FormatPlain, Visibility: models.VisibilityPublic}
+
+	err := app.readJSON(w, r, &form)
+	if err != nil {
+		app.apiErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	form.validate()
+
+	if !form.Valid() {
+		app.apiValidationFailed(w, form.FieldErrors)
+		return
+	}
+
+	id, err := app.Snippets.Insert(app.authenticatedUser(r).ID, form.input())
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	snippet, err := app.Snippets.Get(id)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	// Let the client know where the new snippet can be found.
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/snippets/%d", id))
+
+	app.writeJSON(w, http.StatusCreated, envelope{"snippet": newAPISnippet(snippet)}, headers)
+}
+
+func (app *Application) apiSnippetUpdate(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.apiOwnedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	// Decode the body on top of the current values of the snippet, so that
+	// the fields left out of the request are kept as they are.
+	form := newSnippetEditForm(snippet)
+
+	err := app.readJSON(w, r, &form)
+	if err != nil {
+		app.apiErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	form.validate()
+
+	if !form.Valid() {
+		app.apiValidationFailed(w, form.FieldErrors)
+		return
+	}
+
+	err = app.Snippets.Update(snippet.ID, app.authenticatedUser(r).ID, form.input())
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	snippet, err = app.Snippets.Get(snippet.ID)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"snippet": newAPISnippet(snippet)}, nil)
+}
+
+func (app *Application) apiSnippetDelete(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.apiOwnedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.Snippets.Delete(snippet.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w)
+		} else {
+			app.apiServerError(w, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "snippet successfully deleted"}, nil)
+}
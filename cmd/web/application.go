@@ -12,10 +12,17 @@ import (
 type Application struct {
 	InfoLog        *log.Logger
 	ErrorLog       *log.Logger
-	Snippets       *models.SnippetModel
-	Users          *models.UserModel
+	Snippets       models.SnippetModelInterface
+	Revisions      *models.SnippetRevisionModel
+	Tags           models.TagModelInterface
+	Users          models.UserModelInterface
+	Tokens         models.TokenModelInterface
 	StaticDir      string
 	TemplateCache  map[string]*template.Template
 	FormDecoder    *form.Decoder
 	SessionManager *scs.SessionManager
+
+	// PasswordAttempts limits the failed attempts at the password of a
+	// protected snippet.
+	PasswordAttempts *attemptLimiter
 }
@@ -0,0 +1,7 @@
+package main
+
+type contextKey string
+
+// The authenticated user, loaded by the authenticate middleware, is stored in
+// the request context under this key.
+const authenticatedUserContextKey = contextKey("authenticatedUser")
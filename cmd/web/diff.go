@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"github.com/liviu-moraru/snippetbox/internal/models"
+	"github.com/pmezard/go-difflib/difflib"
+	"strings"
+)
+
+// unifiedDiff returns a unified diff of the files of two revisions of a
+// snippet, with three lines of context. The files are matched by position,
+// and only the ones which changed are included. The first file is named by
+// the title of the revision, so that a change of title is shown in its header
+// lines, and a file added or removed is compared with /dev/null.
+func unifiedDiff(from, to *models.SnippetRevision) (string, error) {
+	fromFiles, toFiles := from.AllFiles(), to.AllFiles()
+
+	var b strings.Builder
+
+	for position := 0; position < len(fromFiles) || position < len(toFiles); position++ {
+		diff := difflib.UnifiedDiff{
+			FromFile: "/dev/null",
+			ToFile:   "/dev/null",
+			Context:  3,
+		}
+
+		if position < len(fromFiles) {
+			diff.A = difflib.SplitLines(fromFiles[position].Content)
+			diff.FromFile = revisionFileName(from, fromFiles[position])
+		}
+		if position < len(toFiles) {
+			diff.B = difflib.SplitLines(toFiles[position].Content)
+			diff.ToFile = revisionFileName(to, toFiles[position])
+		}
+
+		s, err := difflib.GetUnifiedDiffString(diff)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(s)
+	}
+
+	return b.String(), nil
+}
+
+// revisionFileName names a file of a revision in the header lines of a diff.
+func revisionFileName(r *models.SnippetRevision, f *models.SnippetFile) string {
+	if f.Position == 0 {
+		return fmt.Sprintf("%s (revision %d)", r.Title, r.Number)
+	}
+	return fmt.Sprintf("%s (revision %d)", f.Filename, r.Number)
+}
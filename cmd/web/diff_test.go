@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/liviu-moraru/snippetbox/internal/models"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	from := &models.SnippetRevision{
+		Number:  1,
+		Title:   "Pond",
+		Content: "An old silent pond\n",
+		Files: []*models.SnippetFile{
+			{Position: 1, Filename: "frog.txt", Content: "A frog jumps\n"},
+			{Position: 2, Filename: "splash.txt", Content: "Splash!\n"},
+		},
+	}
+	to := &models.SnippetRevision{
+		Number:  2,
+		Title:   "Pond",
+		Content: "An old silent pond\n",
+		Files: []*models.SnippetFile{
+			{Position: 1, Filename: "frog.txt", Content: "A frog jumps into the pond\n"},
+		},
+	}
+
+	diff, err := unifiedDiff(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"--- frog.txt (revision 1)\n+++ frog.txt (revision 2)\n",
+		"-A frog jumps\n+A frog jumps into the pond\n",
+		"--- splash.txt (revision 1)\n+++ /dev/null\n",
+		"-Splash!\n",
+	} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("diff %q doesn't contain %q", diff, want)
+		}
+	}
+
+	// The first file didn't change, so it isn't in the diff.
+	if strings.Contains(diff, "Pond (revision") {
+		t.Errorf("diff %q contains the unchanged first file", diff)
+	}
+}
@@ -1,15 +1,22 @@
 package main
 
 import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/julienschmidt/httprouter"
 	"github.com/liviu-moraru/snippetbox/internal/models"
 	"github.com/liviu-moraru/snippetbox/internal/validator"
+	"mime"
 	"net/http"
 	"os"
 	"path"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 )
 
 func (app *Application) HomeHandler() http.Handler {
@@ -27,97 +34,1301 @@ func (app *Application) HomeHandler() http.Handler {
 	})
 }
 
+// Create a new snippetListForm struct to hold the paging, sorting and filtering
+// options of the snippet listing. Unlike the other forms it is decoded from the
+// query string.
+type snippetListForm struct {
+	Page                int    `form:"page"`
+	PageSize            int    `form:"page_size"`
+	Sort                string `form:"sort"`
+	Author              int    `form:"author"`
+	CreatedAfter        string `form:"created_after"`
+	CreatedBefore       string `form:"created_before"`
+	Expiring            int    `form:"expiring"`
+	Tag                 string `form:"tag"`
+	validator.Validator `form:"-"`
+}
+
+// newSnippetListForm returns a snippetListForm holding the default options.
+func newSnippetListForm() snippetListForm {
+	return snippetListForm{
+		Page:     1,
+		PageSize: 20,
+		Sort:     "-created",
+	}
+}
+
+// The filter method validates the form and converts it into a
+// models.SnippetFilter. The dates are whole days, so created_before is
+// inclusive.
+func (form *snippetListForm) filter() models.SnippetFilter {
+	form.CheckField(form.Page > 0 && form.Page <= 10_000_000, "page", "This field must be between 1 and 10 million")
+	form.CheckField(form.PageSize > 0 && form.PageSize <= 100, "page_size", "This field must be between 1 and 100")
+	form.CheckField(validator.Permitted(form.Sort, models.SnippetSortSafelist...), "sort", "This field has an invalid sort value")
+	form.CheckField(form.Author >= 0, "author", "This field must be a valid user ID")
+	form.CheckField(form.PermittedInt(form.Expiring, 0, 1, 7, 30), "expiring", "This field must equal 0, 1, 7 or 30")
+	form.CheckField(form.Tag == "" || form.Matches(form.Tag, tagRX), "tag", "This field must be a valid tag")
+
+	filter := models.SnippetFilter{
+		Page:           form.Page,
+		PageSize:       form.PageSize,
+		Sort:           form.Sort,
+		AuthorID:       form.Author,
+		ExpiringWithin: time.Duration(form.Expiring) * 24 * time.Hour,
+		Tag:            form.Tag,
+	}
+
+	if form.CreatedAfter != "" {
+		t, err := time.Parse("2006-01-02", form.CreatedAfter)
+		form.CheckField(err == nil, "created_after", "This field must be a date like 2006-01-02")
+		filter.CreatedAfter = t
+	}
+	if form.CreatedBefore != "" {
+		t, err := time.Parse("2006-01-02", form.CreatedBefore)
+		form.CheckField(err == nil, "created_before", "This field must be a date like 2006-01-02")
+		filter.CreatedBefore = t.AddDate(0, 0, 1)
+	}
+
+	return filter
+}
+
+func (app *Application) snippetList(w http.ResponseWriter, r *http.Request) {
+	form := newSnippetListForm()
+
+	err := app.FormDecoder.Decode(&form, r.URL.Query())
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	filter := form.filter()
+
+	data := app.newTemplateData(r)
+	data.Form = form
+
+	if !form.Valid() {
+		app.render(w, http.StatusUnprocessableEntity, "snippets.tmpl", data)
+		return
+	}
+
+	snippets, metadata, err := app.Snippets.List(filter)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data.Snippets = snippets
+	app.setPagination(data, r, metadata)
+
+	app.render(w, http.StatusOK, "snippets.tmpl", data)
+}
+
+// The tagList handler lists all the tags in use, with the number of snippets
+// for each of them.
+func (app *Application) tagList(w http.ResponseWriter, r *http.Request) {
+	tags, err := app.Tags.List()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Tags = tags
+
+	app.render(w, http.StatusOK, "tags.tmpl", data)
+}
+
+// The tagView handler lists the snippets with a tag. It accepts the same
+// paging and sorting options as the snippet listing.
+func (app *Application) tagView(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	name := strings.ToLower(params.ByName("name"))
+	if !tagRX.MatchString(name) {
+		app.notFound(w)
+		return
+	}
+
+	exists, err := app.Tags.Exists(name)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !exists {
+		app.notFound(w)
+		return
+	}
+
+	form := newSnippetListForm()
+
+	err = app.FormDecoder.Decode(&form, r.URL.Query())
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// The tag always comes from the URL path.
+	form.Tag = name
+
+	filter := form.filter()
+	if !form.Valid() {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	snippets, metadata, err := app.Snippets.List(filter)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.Snippets = snippets
+	app.setPagination(data, r, metadata)
+
+	app.render(w, http.StatusOK, "tag.tmpl", data)
+}
+
+// Create a new snippetSearchForm struct, decoded from the query string.
+type snippetSearchForm struct {
+	Query               string `form:"q"`
+	Page                int    `form:"page"`
+	validator.Validator `form:"-"`
+}
+
+func (app *Application) snippetSearch(w http.ResponseWriter, r *http.Request) {
+	form := snippetSearchForm{Page: 1}
+
+	err := app.FormDecoder.Decode(&form, r.URL.Query())
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	data := app.newTemplateData(r)
+
+	// Without a query there is nothing to search for, so just show the form.
+	form.Query = strings.TrimSpace(form.Query)
+	if form.Query == "" {
+		data.Form = form
+		app.render(w, http.StatusOK, "search.tmpl", data)
+		return
+	}
+
+	form.CheckField(form.MaxCharacters(form.Query, 100), "q", "This field cannot be more than 100 characters long")
+	form.CheckField(form.Page > 0 && form.Page <= 10_000_000, "page", "This field must be between 1 and 10 million")
+
+	data.Form = form
+
+	if !form.Valid() {
+		app.render(w, http.StatusUnprocessableEntity, "search.tmpl", data)
+		return
+	}
+
+	snippets, metadata, err := app.Snippets.Search(form.Query, models.SnippetFilter{Page: form.Page, PageSize: 20})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data.Snippets = snippets
+	app.setPagination(data, r, metadata)
+
+	app.render(w, http.StatusOK, "search.tmpl", data)
+}
+
 func (app *Application) SnippetViewHandler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		params := httprouter.ParamsFromContext(r.Context())
 
-		id, err := strconv.Atoi(params.ByName("id"))
+		id, err := strconv.Atoi(params.ByName("id"))
+
+		if err != nil || id < 1 {
+			app.notFound(w)
+			return
+		}
+
+		// Unlisted and private snippets can't be reached by their id, unless
+		// the request comes from their owner.
+		snippet, err := app.Snippets.GetVisible(id, app.authenticatedUserID(r))
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.notFound(w)
+			} else {
+				app.serverError(w, err)
+			}
+			return
+		}
+
+		// Snippets now live at their slug URL. The numeric URLs are only kept
+		// so that old links keep working, so redirect permanently.
+		http.Redirect(w, r, snippetURL(snippet), http.StatusMovedPermanently)
+	})
+}
+
+// The snippetViewBySlug handler shows a snippet reached through its slug.
+// This is the canonical URL of every snippet, and the only way to share
+// unlisted snippets.
+func (app *Application) snippetViewBySlug(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	snippet, err := app.Snippets.GetBySlug(params.ByName("slug"), app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+
+	// Ask for the password of protected snippets, unless it has already been
+	// entered in this session.
+	if !app.isUnlocked(r, snippet) {
+		data.Form = snippetUnlockForm{}
+		app.render(w, http.StatusOK, "unlock.tmpl", data)
+		return
+	}
+
+	// Burn-after-reading snippets are only read after a confirmation, which
+	// is sent with a POST request. Link previewers and crawlers only follow
+	// GET requests, so they can't destroy the snippet before its recipient
+	// gets to see it.
+	if snippet.BurnAfterReading && snippet.UserID != app.authenticatedUserID(r) {
+		app.render(w, http.StatusOK, "burn.tmpl", data)
+		return
+	}
+
+	app.render(w, http.StatusOK, "view.tmpl", data)
+}
+
+// The snippetBurnPost handler shows a burn-after-reading snippet, deleting it
+// at the same time. The owner of the snippet can read it without deleting it,
+// so they are simply sent back to it.
+func (app *Application) snippetBurnPost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	snippet, err := app.Snippets.GetBySlug(params.ByName("slug"), app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	// Protected snippets must be unlocked first; the snippet page asks for
+	// the password.
+	if !snippet.BurnAfterReading || snippet.UserID == app.authenticatedUserID(r) || !app.isUnlocked(r, snippet) {
+		http.Redirect(w, r, snippetURL(snippet), http.StatusSeeOther)
+		return
+	}
+
+	// If someone else burned the snippet in the meantime, Burn() returns
+	// ErrNoRecord and this reader gets a 404 like any later one.
+	snippet, err = app.Snippets.Burn(snippet.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Flash = "This snippet has now been deleted. Copy it before leaving this page!"
+
+	// The page can't be loaded again, so make sure it isn't cached either.
+	w.Header().Set("Cache-Control", "no-store")
+
+	app.render(w, http.StatusOK, "view.tmpl", data)
+}
+
+// Create a new snippetUnlockForm struct to hold the password entered for a
+// protected snippet.
+type snippetUnlockForm struct {
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+// The snippetUnlockPost handler checks the password of a protected snippet,
+// and unlocks the snippet for the rest of the session if it is right. Failed
+// attempts are limited per client and snippet, so that short passwords can't
+// be guessed by trying them all.
+func (app *Application) snippetUnlockPost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	snippet, err := app.Snippets.GetBySlug(params.ByName("slug"), app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if app.isUnlocked(r, snippet) {
+		http.Redirect(w, r, snippetURL(snippet), http.StatusSeeOther)
+		return
+	}
+
+	var form snippetUnlockForm
+
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+
+	key := passwordAttemptKey(r, snippet.ID)
+	if !app.PasswordAttempts.allow(key) {
+		form.AddNonFieldError("Too many incorrect passwords. Please try again later.")
+		data.Form = form
+		app.render(w, http.StatusTooManyRequests, "unlock.tmpl", data)
+		return
+	}
+
+	err = snippet.CheckPassword(form.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.AddNonFieldError("Password is incorrect")
+			data.Form = form
+			app.render(w, http.StatusUnprocessableEntity, "unlock.tmpl", data)
+		} else {
+			app.PasswordAttempts.release(key)
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	// The password was correct, so the attempt doesn't count as a failure.
+	app.PasswordAttempts.release(key)
+
+	app.unlockSnippet(r, snippet.ID)
+
+	http.Redirect(w, r, snippetURL(snippet), http.StatusSeeOther)
+}
+
+func (app *Application) snippetCreate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+
+	data.Form = snippetCreateForm{
+		Language:   "plaintext",
+		Format:     models.FormatPlain,
+		Visibility: models.VisibilityPublic,
+		Expires:    "365d",
+	}
+
+	app.render(w, http.StatusOK, "create.tmpl", data)
+}
+
+// Update our snippetCreateForm struct to include struct tags which tell the
+// decoder how to map HTML form values into the different struct fields. So, for
+// example, here we're telling the decoder to store the value from the HTML form
+// input with the name "title" in the Title field. The struct tag `form:"-"`
+// tells the decoder to completely ignore a field during decoding.
+//
+// The json struct tags let the JSON API decode request bodies into the same
+// struct, so that both share the validation rules.
+type snippetCreateForm struct {
+	Title               string            `form:"title" json:"title"`
+	Content             string            `form:"content" json:"content"`
+	Language            string            `form:"language" json:"language"`
+	Format              string            `form:"format" json:"format"`
+	Visibility          string            `form:"visibility" json:"visibility"`
+	Expires             snippetExpires    `form:"expires" json:"expires"`
+	ExpiresAt           string            `form:"expires_at" json:"expires_at"`
+	CurrentExpires      sql.NullTime      `form:"-" json:"-"`
+	Tags                snippetTags       `form:"tags" json:"tags"`
+	BurnAfterReading    bool              `form:"burn_after_reading" json:"burn_after_reading"`
+	Encrypted           bool              `form:"encrypted" json:"encrypted"`
+	Password            string            `form:"password" json:"password"`
+	RemovePassword      bool              `form:"remove_password" json:"remove_password"`
+	HasPassword         bool              `form:"-" json:"-"`
+	Filename            string            `form:"filename" json:"filename"`
+	Files               []snippetFileForm `form:"files" json:"files"`
+	validator.Validator `form:"-" json:"-"`
+}
+
+// snippetTags holds the tags of the snippet form, as the comma-separated list
+// typed into the HTML form. The JSON API returns the tags as an array, so it
+// also accepts them that way; a comma-separated string still works too.
+type snippetTags string
+
+// joinTags converts a list of tags into snippetTags.
+func joinTags(tags []string) snippetTags {
+	return snippetTags(strings.Join(tags, ", "))
+}
+
+func (t *snippetTags) UnmarshalJSON(data []byte) error {
+	var tags []string
+	if err := json.Unmarshal(data, &tags); err == nil {
+		// A comma would silently turn one tag into two.
+		for _, tag := range tags {
+			if strings.Contains(tag, ",") {
+				return fmt.Errorf("tag %q cannot contain a comma", tag)
+			}
+		}
+		*t = joinTags(tags)
+		return nil
+	}
+
+	var list string
+	err := json.Unmarshal(data, &list)
+	if err != nil {
+		return errors.New("tags must be an array of strings")
+	}
+	*t = snippetTags(list)
+	return nil
+}
+
+// snippetExpires holds the expires field of the snippet form. Version 1 of the
+// JSON API took the number of days the snippet is kept for, so the numbers it
+// accepted (1, 7 and 365) still work alongside the new options.
+type snippetExpires string
+
+func (e *snippetExpires) UnmarshalJSON(data []byte) error {
+	var days int
+	if err := json.Unmarshal(data, &days); err == nil {
+		switch days {
+		case 1, 7, 365:
+			*e = snippetExpires(fmt.Sprintf("%dd", days))
+			return nil
+		}
+		return errors.New("expires must equal 1, 7 or 365 when it is a number of days")
+	}
+
+	var option string
+	err := json.Unmarshal(data, &option)
+	if err != nil {
+		return errors.New("expires must be a string or a number of days")
+	}
+	*e = snippetExpires(option)
+	return nil
+}
+
+// snippetFileForm holds one of the extra files of a snippet. The first file is
+// held in the Filename, Content and Language fields of snippetCreateForm, and
+// the HTML form sends the others as files[0].filename, files[0].language and
+// so on.
+type snippetFileForm struct {
+	Filename string `form:"filename" json:"filename"`
+	Language string `form:"language" json:"language"`
+	Content  string `form:"content" json:"content"`
+}
+
+// snippetFileForms converts the extra files of a snippet, to pre-populate the
+// snippet form.
+func snippetFileForms(files []*models.SnippetFile) []snippetFileForm {
+	var forms []snippetFileForm
+	for _, f := range files {
+		forms = append(forms, snippetFileForm{Filename: f.Filename, Language: f.Language, Content: f.Content})
+	}
+	return forms
+}
+
+// expiryDurations maps the relative expiry options of the snippet form to the
+// time a snippet is kept for. The form also accepts expiryNever, and
+// expiryCustom together with a date and time in the expires_at field. When a
+// snippet is edited, expiryKeep leaves its expiry date as it is.
+var expiryDurations = map[string]time.Duration{
+	"1h":   time.Hour,
+	"6h":   6 * time.Hour,
+	"1d":   24 * time.Hour,
+	"7d":   7 * 24 * time.Hour,
+	"365d": 365 * 24 * time.Hour,
+}
+
+const (
+	expiryNever  = "never"
+	expiryCustom = "custom"
+	expiryKeep   = "keep"
+)
+
+// expiresAtLayout is the format used by the datetime-local input of the form.
+// The times entered there are in UTC, like all the times shown by the site.
+const expiresAtLayout = "2006-01-02T15:04"
+
+// maxExpiresAt is how far in the future a custom expiry date can be.
+const maxExpiresAt = 5 * 365 * 24 * time.Hour
+
+// parseExpiresAt parses the expires_at field. The JSON API can also send an
+// RFC 3339 timestamp, with a time zone.
+func parseExpiresAt(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t.UTC(), nil
+	}
+	return time.Parse(expiresAtLayout, value)
+}
+
+// The expiry method works out the expiry date of the snippet, counting from
+// now. An invalid result means that the snippet never expires. It must only
+// be called once the form has been validated.
+func (form *snippetCreateForm) expiry(now time.Time) sql.NullTime {
+	if d, ok := expiryDurations[string(form.Expires)]; ok {
+		return sql.NullTime{Time: now.Add(d).UTC(), Valid: true}
+	}
+
+	if form.Expires == expiryKeep {
+		return form.CurrentExpires
+	}
+
+	if form.Expires == expiryCustom {
+		t, err := parseExpiresAt(form.ExpiresAt)
+		if err == nil {
+			return sql.NullTime{Time: t, Valid: true}
+		}
+	}
+
+	return sql.NullTime{}
+}
+
+// The input method converts a valid form into the values saved by the
+// snippet model.
+func (form *snippetCreateForm) input() models.SnippetInput {
+	input := models.SnippetInput{
+		Title:      form.Title,
+		Content:    form.Content,
+		Language:   form.Language,
+		Format:     form.Format,
+		Visibility: form.Visibility,
+		Expires:    form.expiry(time.Now()),
+		Tags:       form.tagList(),
+		Filename:   form.Filename,
+
+		BurnAfterReading: form.BurnAfterReading,
+		Encrypted:        form.Encrypted,
+		Password:         form.Password,
+		RemovePassword:   form.RemovePassword,
+	}
+
+	for _, f := range form.Files {
+		input.Files = append(input.Files, models.SnippetFile{Filename: f.Filename, Language: f.Language, Content: f.Content})
+	}
+
+	return input
+}
+
+// The setExpiry method pre-populates the expiry fields of the form from an
+// existing expiry date, so that saving the form doesn't change it. A timed
+// expiry is kept as it is rather than turned into a custom date, which would
+// fail validation once that date had passed. The custom date is still filled
+// in, as a starting point for changing it.
+func (form *snippetCreateForm) setExpiry(expires sql.NullTime) {
+	form.CurrentExpires = expires
+
+	if !expires.Valid {
+		form.Expires = expiryNever
+		return
+	}
+
+	form.Expires = expiryKeep
+	form.ExpiresAt = expires.Time.UTC().Format(expiresAtLayout)
+}
+
+// tagRX matches a valid tag: lower case letters and digits, optionally
+// followed by some of the punctuation found in language names, like c++ or
+// c#.
+var tagRX = regexp.MustCompile(`^[a-z0-9][a-z0-9+#.-]*$`)
+
+// encryptedContentRX matches the content of an encrypted snippet, as produced
+// by main.js: a version prefix followed by the IV and ciphertext, base64url
+// encoded. The server can't check more than the format.
+var encryptedContentRX = regexp.MustCompile(`^e2e:v1:[A-Za-z0-9_-]+$`)
+
+// maxTags is the number of tags which can be given to a snippet.
+const maxTags = 10
+
+// snippetFilenameRX matches a valid name for a file of a snippet. Files are
+// addressed by their position rather than their name, so the name only needs
+// to be safe to download.
+var snippetFilenameRX = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// maxFiles is the number of files a snippet can have, including the first.
+const maxFiles = 10
+
+// The tagList method splits the comma-separated Tags field into a list of
+// tags. The tags are trimmed and lower-cased, and empty or repeated tags are
+// dropped.
+func (form *snippetCreateForm) tagList() []string {
+	var tags []string
+	seen := make(map[string]bool)
+
+	for _, tag := range strings.Split(string(form.Tags), ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+// The validate method runs the checks shared by the create and edit snippet
+// forms.
+func (form *snippetCreateForm) validate() {
+	form.CheckField(form.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(form.MaxCharacters(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+	form.CheckField(form.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.CheckField(validator.Permitted(form.Language, supportedLanguages...), "language", "This field must be a supported language")
+	form.CheckField(validator.Permitted(form.Format, models.Formats...), "format", "This field must equal plain or markdown")
+	form.CheckField(validator.Permitted(form.Visibility, models.Visibilities...), "visibility", "This field must equal public, unlisted or private")
+
+	switch form.Expires {
+	case expiryNever:
+	case expiryKeep:
+		form.CheckField(form.CurrentExpires.Valid, "expires", "This field must equal 1h, 6h, 1d, 7d, 365d, never or custom")
+	case expiryCustom:
+		now := time.Now()
+		t, err := parseExpiresAt(form.ExpiresAt)
+		form.CheckField(err == nil, "expires_at", "This field must be a date and time like 2006-01-02T15:04")
+		if err == nil {
+			form.CheckField(form.Between(t, now, now.Add(maxExpiresAt)), "expires_at", "This field must be in the next 5 years")
+		}
+	default:
+		_, ok := expiryDurations[string(form.Expires)]
+		form.CheckField(ok, "expires", "This field must equal 1h, 6h, 1d, 7d, 365d, never or custom")
+	}
+
+	// Encrypted content must have been encrypted by the browser. Without
+	// JavaScript the plain text would be sent, and must not be stored as if
+	// it were encrypted.
+	if form.Encrypted {
+		form.CheckField(form.Matches(form.Content, encryptedContentRX), "content", "This field must be encrypted in the browser; is JavaScript enabled?")
+		form.CheckField(form.Format != models.FormatMarkdown, "format", "Encrypted snippets can't be rendered as markdown")
+	}
+
+	// The password is optional. bcrypt only uses the first 72 bytes of a
+	// password, so longer ones are refused rather than silently truncated.
+	if form.Password != "" {
+		form.CheckField(form.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+		form.CheckField(len(form.Password) <= 72, "password", "This field cannot be more than 72 bytes long")
+	}
+
+	tags := form.tagList()
+	form.CheckField(len(tags) <= maxTags, "tags", fmt.Sprintf("This field cannot have more than %d tags", maxTags))
+	for _, tag := range tags {
+		form.CheckField(form.MaxCharacters(tag, 32), "tags", "Tags cannot be more than 32 characters long")
+		form.CheckField(form.Matches(tag, tagRX), "tags", "Tags can only contain letters, digits and the characters + # . -")
+	}
+
+	form.validateFiles()
+}
+
+// The validateFiles method checks the names and extra files of the snippet.
+// Errors about an extra file are keyed by its index, like "files.0", and
+// errors about the files as a whole by "files".
+func (form *snippetCreateForm) validateFiles() {
+	form.CheckField(len(form.Files) < maxFiles, "files", fmt.Sprintf("A snippet cannot have more than %d files", maxFiles))
+
+	// The browser only encrypts the content field.
+	form.CheckField(!form.Encrypted || len(form.Files) == 0, "files", "Encrypted snippets can only have one file")
+
+	// Names are optional for a single file, but tell the files apart when
+	// there are several.
+	if len(form.Files) > 0 {
+		form.CheckField(form.NotBlank(form.Filename), "filename", "This field cannot be blank when there are several files")
+	}
+	if form.Filename != "" {
+		form.CheckField(form.MaxCharacters(form.Filename, 100), "filename", "This field cannot be more than 100 characters long")
+		form.CheckField(form.Matches(form.Filename, snippetFilenameRX), "filename", "This field can only contain letters, digits and the characters . _ -")
+	}
+
+	seen := map[string]bool{form.Filename: true}
+	for i, f := range form.Files {
+		key := fmt.Sprintf("files.%d", i)
+		form.CheckField(form.NotBlank(f.Filename), key, "The file name cannot be blank")
+		form.CheckField(form.MaxCharacters(f.Filename, 100), key, "The file name cannot be more than 100 characters long")
+		form.CheckField(form.Matches(f.Filename, snippetFilenameRX), key, "The file name can only contain letters, digits and the characters . _ -")
+		form.CheckField(!seen[f.Filename], key, "The file name is already used by another file")
+		form.CheckField(validator.Permitted(f.Language, supportedLanguages...), key, "The language must be a supported language")
+		form.CheckField(form.NotBlank(f.Content), key, "The content cannot be blank")
+		seen[f.Filename] = true
+	}
+}
+
+func (app *Application) SnippetCreatePostHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var form snippetCreateForm
+
+		err := app.decodePostForm(r, &form)
+		if err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+
+		// Then validate and use the data as normal...
+		form.validate()
+
+		// If there are any validation errors re-display the create.tmpl template,
+		// passing in the snippetCreateForm instance as dynamic data in the Form
+		// field. Note that we use the HTTP status code 422 Unprocessable Entity
+		// when sending the response to indicate that there was a validation error.
+		if !form.Valid() {
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusUnprocessableEntity, "create.tmpl", data)
+			return
+		}
+
+		// We also need to update this line to pass the data from the
+		// snippetCreateForm instance to our Insert() method. The snippet is
+		// owned by the currently authenticated user.
+		user := app.authenticatedUser(r)
+
+		id, err := app.Snippets.Insert(user.ID, form.input())
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		snippet, err := app.Snippets.Get(id)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		// Use the Put() method to add a string value ("Snippet successfully
+		// created!") and the corresponding key ("flash") to the session data.
+		app.SessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
+
+		http.Redirect(w, r, snippetURL(snippet), http.StatusSeeOther)
+	})
+}
+
+// snippetPreviewForm holds the fields of the snippet form which the preview
+// needs. The other fields sent with them are ignored.
+type snippetPreviewForm struct {
+	Content             string `form:"content"`
+	Language            string `form:"language"`
+	Format              string `form:"format"`
+	validator.Validator `form:"-"`
+}
+
+// The snippetPreviewPost handler renders the content of the snippet form the
+// way that the snippet page will show it, for the preview tab of the form. It
+// sends an HTML fragment rather than a whole page.
+func (app *Application) snippetPreviewPost(w http.ResponseWriter, r *http.Request) {
+	var form snippetPreviewForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.Permitted(form.Language, supportedLanguages...), "language", "This field must be a supported language")
+	form.CheckField(validator.Permitted(form.Format, models.Formats...), "format", "This field must equal plain or markdown")
+
+	if !form.Valid() {
+		app.clientError(w, http.StatusUnprocessableEntity)
+		return
+	}
+
+	html := highlight(form.Content, form.Language)
+	if form.Format == models.FormatMarkdown {
+		html, err = markdown(form.Content)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(html))
+}
+
+// The snippetRaw handler sends the content of a file of a snippet as plain
+// text, for use with curl and in scripts.
+func (app *Application) snippetRaw(w http.ResponseWriter, r *http.Request) {
+	_, file, ok := app.visibleSnippetFile(w, r)
+	if !ok {
+		return
+	}
+
+	app.serveSnippetContent(w, r, file.Content, "")
+}
+
+// The snippetDownload handler sends the content of a file of a snippet as a
+// file attachment.
+func (app *Application) snippetDownload(w http.ResponseWriter, r *http.Request) {
+	snippet, file, ok := app.visibleSnippetFile(w, r)
+	if !ok {
+		return
+	}
+
+	app.serveSnippetContent(w, r, file.Content, downloadFilename(snippet, file))
+}
+
+// The visibleSnippetFile helper works like findSnippet, and also looks up the
+// file given by the optional :file parameter, which is its position in the
+// snippet. Without it, the first file is used. The files are fetched by
+// scripts rather than browsers, so a locked snippet gets a 403 Forbidden
+// response in plain text instead of a redirect to its password prompt.
+func (app *Application) visibleSnippetFile(w http.ResponseWriter, r *http.Request) (*models.Snippet, *models.SnippetFile, bool) {
+	snippet, ok := app.findSnippet(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	if !app.isUnlocked(r, snippet) {
+		app.customClientError(w, fmt.Sprintf("This snippet is protected by a password. Unlock it at %s first.", snippetURL(snippet)), http.StatusForbidden)
+		return nil, nil, false
+	}
+
+	position := 0
+	if param := httprouter.ParamsFromContext(r.Context()).ByName("file"); param != "" {
+		var err error
+		position, err = strconv.Atoi(param)
+		if err != nil {
+			app.notFound(w)
+			return nil, nil, false
+		}
+	}
+
+	file := snippet.File(position)
+	if file == nil {
+		app.notFound(w)
+		return nil, nil, false
+	}
+
+	return snippet, file, true
+}
+
+// The serveSnippetContent helper sends the content of a snippet file as UTF-8
+// plain text. If a filename is given, it is sent as an attachment. The ETag
+// is a hash of everything in the response, and http.ServeContent answers a
+// matching If-None-Match header with 304 Not Modified.
+func (app *Application) serveSnippetContent(w http.ResponseWriter, r *http.Request, content string, filename string) {
+	hash := sha256.New()
+	hash.Write([]byte(filename))
+	hash.Write([]byte{0})
+	hash.Write([]byte(content))
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("ETag", fmt.Sprintf(`"%x"`, hash.Sum(nil)))
+
+	// Snippets can change, expire or be made private at any time, so clients
+	// must check the ETag before using a cached copy, and shared caches must
+	// not keep one at all.
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	if filename != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	}
+
+	http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+}
+
+// filenameRX matches the runs of characters which aren't allowed in the
+// filename of a download.
+var filenameRX = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// The downloadFilename helper returns the name of a snippet file download.
+// Files without a name are named after the title of the snippet, keeping only
+// characters which are safe everywhere, with the file extension of their
+// language.
+func downloadFilename(snippet *models.Snippet, file *models.SnippetFile) string {
+	if file.Filename != "" {
+		return file.Filename
+	}
+
+	name := strings.Trim(filenameRX.ReplaceAllString(snippet.Title.String, "-"), "-")
+	if len(name) > 64 {
+		name = strings.TrimRight(name[:64], "-")
+	}
+	if name == "" {
+		name = fmt.Sprintf("snippet-%d", snippet.ID)
+	}
+
+	ext, ok := languageExtensions[file.Language]
+	if !ok {
+		ext = ".txt"
+	}
+
+	return name + ext
+}
+
+// The snippetFork handler shows the create form, pre-filled with a copy of a
+// snippet the user can see.
+func (app *Application) snippetFork(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.visibleSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = snippetCreateForm{
+		Title:      snippet.Title.String,
+		Content:    snippet.Content,
+		Language:   snippet.Language,
+		Format:     snippet.Format,
+		Visibility: models.VisibilityPublic,
+		Expires:    "365d",
+		Tags:       joinTags(snippet.Tags),
+		Encrypted:  snippet.Encrypted,
+		Filename:   snippet.Filename,
+		Files:      snippetFileForms(snippet.Files),
+	}
+
+	app.render(w, http.StatusOK, "create.tmpl", data)
+}
+
+// The snippetForkPost handler creates a new snippet for the user, which
+// records the snippet it was forked from. The source is looked up again, so
+// that users can't fork snippets they aren't allowed to see.
+func (app *Application) snippetForkPost(w http.ResponseWriter, r *http.Request) {
+	parent, ok := app.visibleSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetCreateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.validate()
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = parent
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "create.tmpl", data)
+		return
+	}
+
+	id, err := app.Snippets.Fork(parent.ID, app.authenticatedUserID(r), form.input())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	snippet, err := app.Snippets.Get(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.SessionManager.Put(r.Context(), "flash", "Snippet successfully forked!")
+
+	http.Redirect(w, r, snippetURL(snippet), http.StatusSeeOther)
+}
+
+// visibleSnippet works like findSnippet, and also redirects to the password
+// prompt of the snippet if it is still locked.
+func (app *Application) visibleSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	snippet, ok := app.findSnippet(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	// Send users to the password prompt if the snippet is still locked.
+	if !app.isUnlocked(r, snippet) {
+		http.Redirect(w, r, snippetURL(snippet), http.StatusSeeOther)
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// findSnippet fetches the snippet named by the :slug parameter of the /s/
+// routes, or else by the :id parameter, as long as the user is allowed to see
+// it. Otherwise a 404 Not Found response is sent and false is returned.
+// Unlisted snippets can only be found by their slug. Burn-after-reading
+// snippets can only be read through snippetBurnPost, so they are hidden here
+// from everyone but their owner. Whether the snippet is locked isn't checked.
+func (app *Application) findSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	params := httprouter.ParamsFromContext(r.Context())
 
+	var snippet *models.Snippet
+	var err error
+
+	if slug := params.ByName("slug"); slug != "" {
+		snippet, err = app.Snippets.GetBySlug(slug, app.authenticatedUserID(r))
+	} else {
+		var id int
+		id, err = strconv.Atoi(params.ByName("id"))
 		if err != nil || id < 1 {
 			app.notFound(w)
-			return
+			return nil, false
 		}
+		snippet, err = app.Snippets.GetVisible(id, app.authenticatedUserID(r))
+	}
 
-		snippet, err := app.Snippets.Get(id)
-		if err != nil {
-			if errors.Is(err, models.ErrNoRecord) {
-				app.notFound(w)
-			} else {
-				app.serverError(w, err)
-			}
-			return
+	// Snippets the user can't see at all are reported as not found.
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
 		}
+		return nil, false
+	}
+
+	if snippet.BurnAfterReading && snippet.UserID != app.authenticatedUserID(r) {
+		app.notFound(w)
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// ownedSnippet works like visibleSnippet, but also checks that the snippet
+// belongs to the authenticated user. If it belongs to someone else, a 403
+// Forbidden response is sent and false is returned.
+func (app *Application) ownedSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	snippet, ok := app.visibleSnippet(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	// Only the owner of a snippet is allowed to change it.
+	if snippet.UserID != app.authenticatedUserID(r) {
+		app.clientError(w, http.StatusForbidden)
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+func (app *Application) snippetEdit(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = newSnippetEditForm(snippet)
+
+	app.render(w, http.StatusOK, "edit.tmpl", data)
+}
+
+// newSnippetEditForm returns a snippetCreateForm pre-populated with the
+// current values of a snippet, including its expiry date, so that saving it
+// without changes keeps them all.
+func newSnippetEditForm(snippet *models.Snippet) snippetCreateForm {
+	form := snippetCreateForm{
+		Title:      snippet.Title.String,
+		Content:    snippet.Content,
+		Language:   snippet.Language,
+		Format:     snippet.Format,
+		Visibility: snippet.Visibility,
+		Tags:       joinTags(snippet.Tags),
+		Filename:   snippet.Filename,
+		Files:      snippetFileForms(snippet.Files),
+
+		BurnAfterReading: snippet.BurnAfterReading,
+		Encrypted:        snippet.Encrypted,
+		HasPassword:      snippet.Protected(),
+	}
+	form.setExpiry(snippet.Expires)
+
+	return form
+}
+
+func (app *Application) snippetEditPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetCreateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.HasPassword = snippet.Protected()
+	form.CurrentExpires = snippet.Expires
+	form.validate()
 
+	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Snippet = snippet
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "edit.tmpl", data)
+		return
+	}
 
-		app.render(w, http.StatusOK, "view.tmpl", data)
-	})
+	err = app.Snippets.Update(snippet.ID, app.authenticatedUserID(r), form.input())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.SessionManager.Put(r.Context(), "flash", "Snippet successfully updated!")
+
+	http.Redirect(w, r, snippetURL(snippet), http.StatusSeeOther)
 }
 
-func (app *Application) snippetCreate(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
+func (app *Application) snippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
 
-	data.Form = snippetCreateForm{
-		Expires: 365,
+	err := app.Snippets.Delete(snippet.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
 	}
 
-	app.render(w, http.StatusOK, "create.tmpl", data)
+	app.SessionManager.Put(r.Context(), "flash", "Snippet successfully deleted!")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-// Update our snippetCreateForm struct to include struct tags which tell the
-// decoder how to map HTML form values into the different struct fields. So, for
-// example, here we're telling the decoder to store the value from the HTML form
-// input with the name "title" in the Title field. The struct tag `form:"-"`
-// tells the decoder to completely ignore a field during decoding.
-type snippetCreateForm struct {
-	Title               string `form:"title"`
-	Content             string `form:"content"`
-	Expires             int    `form:"expires""`
+// The snippetHistory handler lists all the saved revisions of a snippet.
+func (app *Application) snippetHistory(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.visibleSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := app.Revisions.List(snippet.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Revisions = revisions
+
+	app.render(w, http.StatusOK, "history.tmpl", data)
+}
+
+// Create a new snippetDiffForm struct, decoded from the query string, to hold
+// the numbers of the two revisions to compare.
+type snippetDiffForm struct {
+	From                int  `form:"from"`
+	To                  int  `form:"to"`
+	Encrypted           bool `form:"-"`
 	validator.Validator `form:"-"`
 }
 
-func (app *Application) SnippetCreatePostHandler() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var form snippetCreateForm
+// The snippetDiff handler shows a unified diff between two revisions of a
+// snippet.
+func (app *Application) snippetDiff(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.visibleSnippet(w, r)
+	if !ok {
+		return
+	}
 
-		err := app.decodePostForm(r, &form)
-		if err != nil {
-			app.clientError(w, http.StatusBadRequest)
-			return
-		}
+	var form snippetDiffForm
 
-		// Then validate and use the data as normal...
-		form.CheckField(form.NotBlank(form.Title), "title", "This field cannot be blank")
-		form.CheckField(form.MaxCharacters(form.Title, 100), "title", "This field cannot be more than 100 characters long")
-		form.CheckField(form.NotBlank(form.Content), "content", "This field cannot be blank")
-		form.CheckField(form.PermittedInt(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	err := app.FormDecoder.Decode(&form, r.URL.Query())
+	if err != nil || form.From < 1 || form.To < 1 {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
 
-		// If there are any validation errors re-display the create.tmpl template,
-		// passing in the snippetCreateForm instance as dynamic data in the Form
-		// field. Note that we use the HTTP status code 422 Unprocessable Entity
-		// when sending the response to indicate that there was a validation error.
-		if !form.Valid() {
-			data := app.newTemplateData(r)
-			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "create.tmpl", data)
-			return
+	from, err := app.Revisions.Get(snippet.ID, form.From)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
 		}
+		return
+	}
 
-		// We also need to update this line to pass the data from the
-		// snippetCreateForm instance to our Insert() method.
-		id, err := app.Snippets.Insert(form.Title, form.Content, form.Expires)
-		if err != nil {
+	to, err := app.Revisions.Get(snippet.ID, form.To)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
 			app.serverError(w, err)
-			return
 		}
+		return
+	}
 
-		// Use the Put() method to add a string value ("Snippet successfully
-		// created!") and the corresponding key ("flash") to the session data.
-		app.SessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
 
-		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
-	})
+	// A diff of ciphertext means nothing, so encrypted revisions aren't
+	// compared.
+	if from.Encrypted || to.Encrypted {
+		form.Encrypted = true
+		data.Form = form
+		app.render(w, http.StatusOK, "diff.tmpl", data)
+		return
+	}
+
+	diff, err := unifiedDiff(from, to)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data.Form = form
+	data.Diff = diff
+
+	app.render(w, http.StatusOK, "diff.tmpl", data)
+}
+
+// The snippetRestorePost handler makes an old revision the current version of
+// a snippet. Only the owner of the snippet can do this.
+func (app *Application) snippetRestorePost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	params := httprouter.ParamsFromContext(r.Context())
+
+	number, err := strconv.Atoi(params.ByName("number"))
+	if err != nil || number < 1 {
+		app.notFound(w)
+		return
+	}
+
+	// Make sure that the revision exists before restoring it.
+	_, err = app.Revisions.Get(snippet.ID, number)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	err = app.Revisions.Restore(snippet.ID, number, app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.SessionManager.Put(r.Context(), "flash", fmt.Sprintf("Revision %d successfully restored!", number))
+
+	http.Redirect(w, r, snippetURL(snippet), http.StatusSeeOther)
 }
 
 // Create a new userSignupForm struct.
@@ -251,7 +1462,7 @@ func (app *Application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 
 	// Add the ID of the current user to the session, so that they are now
 	// 'logged in'.
-	app.SessionManager.Put(r.Context(), "authenticatedUserID", u.Name)
+	app.SessionManager.Put(r.Context(), "authenticatedUserID", u.ID)
 
 	// Redirect the user to the create snippet page.
 	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
@@ -277,6 +1488,96 @@ func (app *Application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
+// Create a new apiTokenForm struct.
+type apiTokenForm struct {
+	Name                string `form:"name"`
+	validator.Validator `form:"-"`
+}
+
+// The accountTokens handler lists the user's personal API tokens together with
+// a form to create a new one. A token that has just been created is shown
+// once, straight after the redirect from accountTokensPost.
+func (app *Application) accountTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := app.Tokens.List(app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Tokens = tokens
+	data.NewToken = app.SessionManager.PopString(r.Context(), "newToken")
+	data.Form = apiTokenForm{}
+
+	app.render(w, http.StatusOK, "tokens.tmpl", data)
+}
+
+func (app *Application) accountTokensPost(w http.ResponseWriter, r *http.Request) {
+	var form apiTokenForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(form.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(form.MaxCharacters(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+
+	user := app.authenticatedUser(r)
+
+	if !form.Valid() {
+		tokens, err := app.Tokens.List(user.ID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		data := app.newTemplateData(r)
+		data.Tokens = tokens
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "tokens.tmpl", data)
+		return
+	}
+
+	token, err := app.Tokens.Insert(user.ID, form.Name)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Keep the plain-text token in the session just long enough to show it
+	// to the user on the next page.
+	app.SessionManager.Put(r.Context(), "newToken", token)
+	app.SessionManager.Put(r.Context(), "flash", "Token successfully created! Copy it now, it won't be shown again.")
+
+	http.Redirect(w, r, "/account/tokens", http.StatusSeeOther)
+}
+
+func (app *Application) accountTokenRevokePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	err = app.Tokens.Delete(id, app.authenticatedUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.SessionManager.Put(r.Context(), "flash", "Token successfully revoked!")
+
+	http.Redirect(w, r, "/account/tokens", http.StatusSeeOther)
+}
+
 func (app *Application) NoDirListingHandler(d http.Dir) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		params := httprouter.ParamsFromContext(r.Context())
@@ -0,0 +1,1243 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/go-playground/form/v4"
+	"github.com/liviu-moraru/snippetbox/internal/models"
+	"github.com/liviu-moraru/snippetbox/internal/models/mocks"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnippetCreateFormTagList(t *testing.T) {
+	tests := []struct {
+		name string
+		tags snippetTags
+		want []string
+	}{
+		{"Empty", "", nil},
+		{"Only commas", " , ,", nil},
+		{"Trims and lower-cases", " Go,  HTTP ", []string{"go", "http"}},
+		{"Drops repeated tags", "go, web, GO", []string{"go", "web"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := snippetCreateForm{Tags: tt.tags}
+			got := form.tagList()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnippetCreateFormValidateTags(t *testing.T) {
+	form := snippetCreateForm{
+		Title:      "Title",
+		Content:    "Content",
+		Language:   "go",
+		Format:     "plain",
+		Visibility: "public",
+		Expires:    "7d",
+		Tags:       "go, c++, no spaces",
+	}
+
+	form.validate()
+
+	if _, ok := form.FieldErrors["tags"]; !ok {
+		t.Errorf("expected an error for the tags field; got %v", form.FieldErrors)
+	}
+
+	form = snippetCreateForm{
+		Title:      "Title",
+		Content:    "Content",
+		Language:   "go",
+		Format:     "plain",
+		Visibility: "public",
+		Expires:    "7d",
+		Tags:       "go, c++, c#",
+	}
+
+	form.validate()
+
+	if !form.Valid() {
+		t.Errorf("unexpected errors: %v", form.FieldErrors)
+	}
+}
+
+func TestSnippetCreateFormValidateExpiry(t *testing.T) {
+	now := time.Now().UTC()
+
+	tests := []struct {
+		name      string
+		expires   snippetExpires
+		expiresAt string
+		valid     bool
+	}{
+		{"Hours", "6h", "", true},
+		{"Never", "never", "", true},
+		{"Unknown option", "2w", "", false},
+		{"Custom", "custom", now.Add(48 * time.Hour).Format(expiresAtLayout), true},
+		{"Custom RFC 3339", "custom", now.Add(48 * time.Hour).Format(time.RFC3339), true},
+		{"Custom in the past", "custom", now.Add(-time.Hour).Format(expiresAtLayout), false},
+		{"Custom too far", "custom", now.AddDate(6, 0, 0).Format(expiresAtLayout), false},
+		{"Custom without a date", "custom", "", false},
+		{"Keep without an expiry", "keep", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := snippetCreateForm{
+				Title:      "Title",
+				Content:    "Content",
+				Language:   "go",
+				Format:     "plain",
+				Visibility: "public",
+				Expires:    tt.expires,
+				ExpiresAt:  tt.expiresAt,
+			}
+
+			form.validate()
+
+			if form.Valid() != tt.valid {
+				t.Errorf("got valid %t; want %t (errors: %v)", form.Valid(), tt.valid, form.FieldErrors)
+			}
+		})
+	}
+}
+
+func TestSnippetCreateFormExpiry(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	form := snippetCreateForm{Expires: "1h"}
+	if got := form.expiry(now); !got.Valid || !got.Time.Equal(now.Add(time.Hour)) {
+		t.Errorf("got %v; want one hour from now", got)
+	}
+
+	form = snippetCreateForm{Expires: "never"}
+	if got := form.expiry(now); got.Valid {
+		t.Errorf("got %v; want no expiry", got)
+	}
+
+	form = snippetCreateForm{Expires: "custom", ExpiresAt: "2022-07-01T09:30"}
+	want := time.Date(2022, 7, 1, 9, 30, 0, 0, time.UTC)
+	if got := form.expiry(now); !got.Valid || !got.Time.Equal(want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
+
+func TestSnippetEditFormKeepExpiry(t *testing.T) {
+	// The snippet was created with a timed expiry, which is less than a day
+	// away when it is edited.
+	expires := sql.NullTime{Time: time.Now().UTC().Add(time.Hour).Truncate(time.Second), Valid: true}
+	snippet := &models.Snippet{
+		Title:      sql.NullString{String: "An old silent pond", Valid: true},
+		Content:    "An old silent pond...",
+		Language:   "plaintext",
+		Format:     models.FormatPlain,
+		Visibility: models.VisibilityPublic,
+		Expires:    expires,
+	}
+
+	form := newSnippetEditForm(snippet)
+	if form.Expires != expiryKeep {
+		t.Errorf("got expires %q; want %q", form.Expires, expiryKeep)
+	}
+
+	form.validate()
+	if !form.Valid() {
+		t.Fatalf("got errors %v; want a valid form", form.FieldErrors)
+	}
+
+	if got := form.expiry(time.Now().Add(time.Minute)); got != expires {
+		t.Errorf("got %v; want the expiry unchanged at %v", got, expires)
+	}
+
+	// Snippets which never expire keep doing so.
+	snippet.Expires = sql.NullTime{}
+	form = newSnippetEditForm(snippet)
+	if form.Expires != expiryNever {
+		t.Errorf("got expires %q; want %q", form.Expires, expiryNever)
+	}
+}
+
+func TestSnippetCreateFormValidateEncrypted(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		valid   bool
+	}{
+		{"Ciphertext", "e2e:v1:xbWIbQfvWoqd2_-A", true},
+		{"Plain text", "my secret token", false},
+		{"Missing prefix", "xbWIbQfvWoqd2", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := snippetCreateForm{
+				Title:      "Title",
+				Content:    tt.content,
+				Language:   "plaintext",
+				Format:     "plain",
+				Visibility: "public",
+				Expires:    "7d",
+				Encrypted:  true,
+			}
+
+			form.validate()
+
+			if form.Valid() != tt.valid {
+				t.Errorf("got valid %t; want %t (errors: %v)", form.Valid(), tt.valid, form.FieldErrors)
+			}
+		})
+	}
+}
+
+func TestSnippetCreateFormValidateFormat(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    string
+		encrypted bool
+		valid     bool
+	}{
+		{"Plain", "plain", false, true},
+		{"Markdown", "markdown", false, true},
+		{"Unknown format", "html", false, false},
+		{"Encrypted plain", "plain", true, true},
+		{"Encrypted markdown", "markdown", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := snippetCreateForm{
+				Title:      "Title",
+				Content:    "e2e:v1:xbWIbQfvWoqd2_-A",
+				Language:   "plaintext",
+				Format:     tt.format,
+				Visibility: "public",
+				Expires:    "7d",
+				Encrypted:  tt.encrypted,
+			}
+
+			form.validate()
+
+			if form.Valid() != tt.valid {
+				t.Errorf("got valid %t; want %t (errors: %v)", form.Valid(), tt.valid, form.FieldErrors)
+			}
+		})
+	}
+}
+
+func TestSnippetCreateFormValidateFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		files    []snippetFileForm
+		key      string
+	}{
+		{"Single file without name", "", nil, ""},
+		{"Several files", "main.go", []snippetFileForm{{"main_test.go", "go", "Test"}}, ""},
+		{"First file without name", "", []snippetFileForm{{"main_test.go", "go", "Test"}}, "filename"},
+		{"Extra file without name", "main.go", []snippetFileForm{{"", "go", "Test"}}, "files.0"},
+		{"Repeated name", "main.go", []snippetFileForm{{"go.mod", "plaintext", "Module"}, {"main.go", "go", "Test"}}, "files.1"},
+		{"Directory in name", "main.go", []snippetFileForm{{"../main_test.go", "go", "Test"}}, "files.0"},
+		{"Unsupported language", "main.go", []snippetFileForm{{"main.zig", "zig", "Test"}}, "files.0"},
+		{"Blank content", "main.go", []snippetFileForm{{"main_test.go", "go", " "}}, "files.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := snippetCreateForm{
+				Title:      "Title",
+				Content:    "Content",
+				Language:   "go",
+				Format:     "plain",
+				Visibility: "public",
+				Expires:    "7d",
+				Filename:   tt.filename,
+				Files:      tt.files,
+			}
+
+			form.validate()
+
+			if tt.key == "" {
+				if !form.Valid() {
+					t.Errorf("unexpected errors %v", form.FieldErrors)
+				}
+				return
+			}
+			if _, ok := form.FieldErrors[tt.key]; !ok || len(form.FieldErrors) != 1 {
+				t.Errorf("got errors %v; want one for %q", form.FieldErrors, tt.key)
+			}
+		})
+	}
+}
+
+func TestDownloadFilename(t *testing.T) {
+	tests := []struct {
+		name     string
+		title    string
+		filename string
+		language string
+		want     string
+	}{
+		{"Plain text", "An old silent pond", "", "plaintext", "An-old-silent-pond.txt"},
+		{"Language extension", "main", "", "go", "main.go"},
+		{"Unsafe characters", `../"quoted" name;`, "", "python", "quoted-name.py"},
+		{"No usable characters", "!!!", "", "bash", "snippet-7.sh"},
+		{"File name", "main", "server.go", "go", "server.go"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snippet := &models.Snippet{
+				ID:       7,
+				Title:    sql.NullString{String: tt.title, Valid: true},
+				Filename: tt.filename,
+				Language: tt.language,
+			}
+
+			if got := downloadFilename(snippet, snippet.File(0)); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeSnippetContent(t *testing.T) {
+	app := &Application{}
+	snippet := &models.Snippet{ID: 1, Content: "héllo\n", Language: "plaintext"}
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/snippet/download/1", nil)
+	app.serveSnippetContent(rr, r, snippet.Content, "hello.txt")
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", rr.Code, http.StatusOK)
+	}
+	if got := rr.Header().Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("got Content-Type %q", got)
+	}
+	if got := rr.Header().Get("Content-Disposition"); got != "attachment; filename=hello.txt" {
+		t.Errorf("got Content-Disposition %q", got)
+	}
+	if rr.Body.String() != snippet.Content {
+		t.Errorf("got body %q", rr.Body.String())
+	}
+
+	etag := rr.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag header")
+	}
+
+	// A request with the same ETag gets an empty 304 response.
+	rr = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/snippet/download/1", nil)
+	r.Header.Set("If-None-Match", etag)
+	app.serveSnippetContent(rr, r, snippet.Content, "hello.txt")
+
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("got status %d; want %d", rr.Code, http.StatusNotModified)
+	}
+	if rr.Body.Len() != 0 {
+		t.Errorf("got body %q; want none", rr.Body.String())
+	}
+
+	// The raw content has a different ETag, since the response differs.
+	rr = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/snippet/raw/1", nil)
+	app.serveSnippetContent(rr, r, snippet.Content, "")
+
+	if rr.Header().Get("ETag") == etag {
+		t.Error("raw and download responses have the same ETag")
+	}
+	if rr.Header().Get("Content-Disposition") != "" {
+		t.Error("raw response is sent as an attachment")
+	}
+}
+
+func TestSnippetPreviewPost(t *testing.T) {
+	app := &Application{FormDecoder: form.NewDecoder()}
+
+	tests := []struct {
+		name     string
+		format   string
+		wantCode int
+		wantBody string
+	}{
+		{"Plain", "plain", http.StatusOK, `class="chroma"`},
+		{"Markdown", "markdown", http.StatusOK, "<h1"},
+		{"Unknown format", "html", http.StatusUnprocessableEntity, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := url.Values{"content": {"# Notes <script>"}, "language": {"plaintext"}, "format": {tt.format}}
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/snippet/preview", strings.NewReader(body.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			app.snippetPreviewPost(rr, r)
+
+			if rr.Code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", rr.Code, tt.wantCode)
+			}
+			if !strings.Contains(rr.Body.String(), tt.wantBody) {
+				t.Errorf("%q not found in %s", tt.wantBody, rr.Body.String())
+			}
+			if strings.Contains(rr.Body.String(), "<script>") {
+				t.Errorf("content not escaped: %s", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestUserLoginPost(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	err := app.Users.Insert("Alice Jones", "alice@example.com", "pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, body := ts.get(t, "/user/login")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		email        string
+		password     string
+		csrfToken    string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{
+			name:         "Valid credentials",
+			email:        "alice@example.com",
+			password:     "pa$$word",
+			csrfToken:    validCSRFToken,
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/create",
+		},
+		{
+			name:      "Wrong password",
+			email:     "alice@example.com",
+			password:  "wrong-password",
+			csrfToken: validCSRFToken,
+			wantCode:  http.StatusUnprocessableEntity,
+			wantBody:  "Email or password is incorrect",
+		},
+		{
+			name:      "Unknown email",
+			email:     "bob@example.com",
+			password:  "pa$$word",
+			csrfToken: validCSRFToken,
+			wantCode:  http.StatusUnprocessableEntity,
+			wantBody:  "Email or password is incorrect",
+		},
+		{
+			name:      "Invalid CSRF token",
+			email:     "alice@example.com",
+			password:  "pa$$word",
+			csrfToken: "wrongToken",
+			wantCode:  http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("email", tt.email)
+			form.Add("password", tt.password)
+			form.Add("csrf_token", tt.csrfToken)
+
+			code, header, body := ts.postForm(t, "/user/login", form)
+
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+			if location := header.Get("Location"); location != tt.wantLocation {
+				t.Errorf("got location %q; want %q", location, tt.wantLocation)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body doesn't contain %q", tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetCreate(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	err := app.Users.Insert("Alice Jones", "alice@example.com", "pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		code, header, _ := ts.get(t, "/snippet/create")
+
+		if code != http.StatusSeeOther {
+			t.Errorf("got status %d; want %d", code, http.StatusSeeOther)
+		}
+		if location := header.Get("Location"); location != "/user/login" {
+			t.Errorf("got location %q; want %q", location, "/user/login")
+		}
+	})
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	code, _, body := ts.get(t, "/snippet/create")
+	if code != http.StatusOK {
+		t.Fatalf("got status %d for the form; want %d", code, http.StatusOK)
+	}
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		title    string
+		expires  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid submission",
+			title:    "An old silent pond",
+			expires:  "7d",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Empty title",
+			title:    "",
+			expires:  "7d",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field cannot be blank",
+		},
+		{
+			name:     "Invalid expiry",
+			title:    "An old silent pond",
+			expires:  "2d",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field must equal 1h, 6h, 1d, 7d, 365d, never or custom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", tt.title)
+			form.Add("content", "An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.")
+			form.Add("language", "plaintext")
+			form.Add("format", "plain")
+			form.Add("visibility", "public")
+			form.Add("expires", tt.expires)
+			form.Add("csrf_token", csrfToken)
+
+			code, header, body := ts.postForm(t, "/snippet/create", form)
+
+			if code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", code, tt.wantCode)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body doesn't contain %q", tt.wantBody)
+			}
+			if code != http.StatusSeeOther {
+				return
+			}
+
+			// The new snippet is shown at the location of the redirect, with
+			// the flash message.
+			location := header.Get("Location")
+			if !strings.HasPrefix(location, "/s/") {
+				t.Fatalf("got location %q; want a snippet URL", location)
+			}
+
+			code, _, body = ts.get(t, location)
+			if code != http.StatusOK {
+				t.Errorf("got status %d for the snippet; want %d", code, http.StatusOK)
+			}
+			for _, want := range []string{tt.title, "Snippet successfully created!"} {
+				if !strings.Contains(body, want) {
+					t.Errorf("snippet page doesn't contain %q", want)
+				}
+			}
+		})
+	}
+}
+
+func TestSnippetViewBySlugExpired(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	now := time.Now()
+	snippets := &mocks.SnippetModel{Now: func() time.Time { return now }}
+	app.Snippets = snippets
+
+	input := models.SnippetInput{
+		Title:      "An old silent pond",
+		Content:    "An old silent pond...",
+		Language:   "plaintext",
+		Format:     models.FormatPlain,
+		Visibility: models.VisibilityPublic,
+		Expires:    sql.NullTime{Time: now.Add(time.Hour), Valid: true},
+	}
+
+	id, err := snippets.Insert(1, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := snippets.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, _ := ts.get(t, "/s/"+s.Slug)
+	if code != http.StatusOK {
+		t.Errorf("got status %d before the expiry; want %d", code, http.StatusOK)
+	}
+
+	now = now.Add(2 * time.Hour)
+
+	code, _, _ = ts.get(t, "/s/"+s.Slug)
+	if code != http.StatusNotFound {
+		t.Errorf("got status %d after the expiry; want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestSnippetEdit(t *testing.T) {
+	app := newTestApplication(t)
+	newTestUsers(t, app)
+
+	snippet := insertSnippet(t, app, 1, newSnippetInput("An old silent pond"))
+	editPath := fmt.Sprintf("/snippet/edit/%d", snippet.ID)
+
+	anonymous := newTestServer(t, app.routes())
+	alice := newTestServer(t, app.routes())
+	alice.login(t, "alice@example.com", "pa$$word")
+	bob := newTestServer(t, app.routes())
+	bob.login(t, "bob@example.com", "pa$$word")
+
+	tests := []struct {
+		name         string
+		ts           *testServer
+		wantCode     int
+		wantLocation string
+	}{
+		{"Anonymous", anonymous, http.StatusSeeOther, "/user/login"},
+		{"Not the owner", bob, http.StatusForbidden, ""},
+		{"Owner", alice, http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+" form", func(t *testing.T) {
+			code, header, body := tt.ts.get(t, editPath)
+
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+			if location := header.Get("Location"); location != tt.wantLocation {
+				t.Errorf("got location %q; want %q", location, tt.wantLocation)
+			}
+			if code == http.StatusOK && !strings.Contains(body, snippet.Title.String) {
+				t.Errorf("form doesn't contain the title %q", snippet.Title.String)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		name         string
+		ts           *testServer
+		wantCode     int
+		wantLocation string
+	}{
+		{"Anonymous", anonymous, http.StatusSeeOther, "/user/login"},
+		{"Not the owner", bob, http.StatusForbidden, ""},
+		{"Owner", alice, http.StatusSeeOther, snippetURL(snippet)},
+	} {
+		t.Run(tt.name+" submission", func(t *testing.T) {
+			// Any page has a CSRF token for the session.
+			_, _, body := tt.ts.get(t, "/user/login")
+			if tt.ts == alice {
+				_, _, body = tt.ts.get(t, editPath)
+			}
+
+			form := snippetFormValues(tt.name+" was here", extractCSRFToken(t, body))
+			code, header, _ := tt.ts.postForm(t, editPath, form)
+
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+			if location := header.Get("Location"); location != tt.wantLocation {
+				t.Errorf("got location %q; want %q", location, tt.wantLocation)
+			}
+		})
+	}
+
+	// Only the owner's change has been saved.
+	s, err := app.Snippets.Get(snippet.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Title.String != "Owner was here" {
+		t.Errorf("got title %q; want %q", s.Title.String, "Owner was here")
+	}
+}
+
+func TestSnippetDeletePost(t *testing.T) {
+	app := newTestApplication(t)
+	newTestUsers(t, app)
+
+	snippet := insertSnippet(t, app, 1, newSnippetInput("An old silent pond"))
+	deletePath := fmt.Sprintf("/snippet/delete/%d", snippet.ID)
+
+	anonymous := newTestServer(t, app.routes())
+	alice := newTestServer(t, app.routes())
+	alice.login(t, "alice@example.com", "pa$$word")
+	bob := newTestServer(t, app.routes())
+	bob.login(t, "bob@example.com", "pa$$word")
+
+	// The owner comes last, once the others have failed to delete the
+	// snippet.
+	tests := []struct {
+		name         string
+		ts           *testServer
+		wantCode     int
+		wantLocation string
+		wantDeleted  bool
+	}{
+		{"Anonymous", anonymous, http.StatusSeeOther, "/user/login", false},
+		{"Not the owner", bob, http.StatusForbidden, "", false},
+		{"Owner", alice, http.StatusSeeOther, "/", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, body := tt.ts.get(t, "/user/login")
+			if tt.ts == alice {
+				_, _, body = tt.ts.get(t, snippetURL(snippet))
+			}
+
+			form := url.Values{}
+			form.Add("csrf_token", extractCSRFToken(t, body))
+			code, header, _ := tt.ts.postForm(t, deletePath, form)
+
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+			if location := header.Get("Location"); location != tt.wantLocation {
+				t.Errorf("got location %q; want %q", location, tt.wantLocation)
+			}
+
+			_, err := app.Snippets.Get(snippet.ID)
+			if deleted := errors.Is(err, models.ErrNoRecord); deleted != tt.wantDeleted {
+				t.Errorf("got deleted %t; want %t", deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+func TestAccountTokens(t *testing.T) {
+	app := newTestApplication(t)
+	newTestUsers(t, app)
+
+	alice := newTestServer(t, app.routes())
+	alice.login(t, "alice@example.com", "pa$$word")
+	bob := newTestServer(t, app.routes())
+	bob.login(t, "bob@example.com", "pa$$word")
+
+	// createSnippet calls an API endpoint which needs authentication.
+	createSnippet := func(t *testing.T, token string) int {
+		t.Helper()
+
+		header := make(http.Header)
+		header.Set("Authorization", "Bearer "+token)
+		body := `{"title": "An old silent pond", "content": "An old silent pond...", "expires": "7d"}`
+		code, _, _ := alice.request(t, http.MethodPost, "/api/v1/snippets", header, body)
+		return code
+	}
+
+	_, _, body := alice.get(t, "/account/tokens")
+	csrfToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("name", "")
+	form.Add("csrf_token", csrfToken)
+	code, _, _ := alice.postForm(t, "/account/tokens", form)
+	if code != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d for a token without a name; want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	form.Set("name", "ci")
+	code, header, _ := alice.postForm(t, "/account/tokens", form)
+	if code != http.StatusSeeOther || header.Get("Location") != "/account/tokens" {
+		t.Fatalf("got status %d and location %q for a new token", code, header.Get("Location"))
+	}
+
+	// The new token is shown once, after the redirect.
+	_, _, body = alice.get(t, "/account/tokens")
+	matches := regexp.MustCompile(`<pre><code>([A-Za-z0-9_-]+)</code></pre>`).FindStringSubmatch(body)
+	if matches == nil {
+		t.Fatal("the new token isn't shown")
+	}
+	token := matches[1]
+
+	_, _, body = alice.get(t, "/account/tokens")
+	if strings.Contains(body, token) {
+		t.Error("the new token is shown twice")
+	}
+
+	if code := createSnippet(t, token); code != http.StatusCreated {
+		t.Errorf("got status %d with the new token; want %d", code, http.StatusCreated)
+	}
+
+	tokens, err := app.Tokens.List(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].Name != "ci" || !tokens[0].LastUsed.Valid {
+		t.Fatalf("unexpected tokens %+v", tokens)
+	}
+	revokePath := fmt.Sprintf("/account/tokens/revoke/%d", tokens[0].ID)
+
+	// Other users can't revoke the token.
+	_, _, body = bob.get(t, "/account/tokens")
+	form = url.Values{}
+	form.Add("csrf_token", extractCSRFToken(t, body))
+	code, _, _ = bob.postForm(t, revokePath, form)
+	if code != http.StatusNotFound {
+		t.Errorf("got status %d revoking the token of another user; want %d", code, http.StatusNotFound)
+	}
+	if code := createSnippet(t, token); code != http.StatusCreated {
+		t.Errorf("got status %d after another user tried to revoke the token; want %d", code, http.StatusCreated)
+	}
+
+	form.Set("csrf_token", csrfToken)
+	code, header, _ = alice.postForm(t, revokePath, form)
+	if code != http.StatusSeeOther || header.Get("Location") != "/account/tokens" {
+		t.Errorf("got status %d and location %q revoking the token", code, header.Get("Location"))
+	}
+	if code := createSnippet(t, token); code != http.StatusUnauthorized {
+		t.Errorf("got status %d with the revoked token; want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestSnippetVisibility(t *testing.T) {
+	app := newTestApplication(t)
+	newTestUsers(t, app)
+
+	snippets := make(map[string]*models.Snippet)
+	for _, visibility := range models.Visibilities {
+		input := newSnippetInput(visibility + " pond")
+		input.Visibility = visibility
+		snippets[visibility] = insertSnippet(t, app, 1, input)
+	}
+
+	anonymous := newTestServer(t, app.routes())
+	alice := newTestServer(t, app.routes())
+	alice.login(t, "alice@example.com", "pa$$word")
+	bob := newTestServer(t, app.routes())
+	bob.login(t, "bob@example.com", "pa$$word")
+
+	viewers := []struct {
+		name  string
+		ts    *testServer
+		owner bool
+	}{
+		{"Anonymous", anonymous, false},
+		{"Other user", bob, false},
+		{"Owner", alice, true},
+	}
+
+	for _, viewer := range viewers {
+		// Only public snippets are listed, even to their owner.
+		for _, path := range []string{"/", "/snippets", "/snippet/search?q=pond"} {
+			t.Run(viewer.name+" "+path, func(t *testing.T) {
+				code, _, body := viewer.ts.get(t, path)
+				if code != http.StatusOK {
+					t.Fatalf("got status %d; want %d", code, http.StatusOK)
+				}
+				for visibility, s := range snippets {
+					listed := strings.Contains(body, `href="`+snippetURL(s)+`"`)
+					if want := visibility == models.VisibilityPublic; listed != want {
+						t.Errorf("got %s snippet listed %t; want %t", visibility, listed, want)
+					}
+				}
+			})
+		}
+
+		for visibility, s := range snippets {
+			// Numeric IDs only lead to public snippets, unless the viewer is
+			// the owner.
+			t.Run(fmt.Sprintf("%s %s by ID", viewer.name, visibility), func(t *testing.T) {
+				want := http.StatusNotFound
+				if visibility == models.VisibilityPublic || viewer.owner {
+					want = http.StatusMovedPermanently
+				}
+
+				code, _, _ := viewer.ts.get(t, fmt.Sprintf("/snippet/view/%d", s.ID))
+				if code != want {
+					t.Errorf("got status %d; want %d", code, want)
+				}
+			})
+
+			// Slugs lead to public and unlisted snippets.
+			t.Run(fmt.Sprintf("%s %s by slug", viewer.name, visibility), func(t *testing.T) {
+				want := http.StatusNotFound
+				if visibility != models.VisibilityPrivate || viewer.owner {
+					want = http.StatusOK
+				}
+
+				code, _, body := viewer.ts.get(t, snippetURL(s))
+				if code != want {
+					t.Errorf("got status %d; want %d", code, want)
+				}
+				if code == http.StatusOK && !strings.Contains(body, s.Title.String) {
+					t.Errorf("body doesn't contain %q", s.Title.String)
+				}
+			})
+		}
+	}
+}
+
+func TestSnippetUnlockPost(t *testing.T) {
+	// newProtectedSnippet returns a test server and a snippet of Alice's
+	// protected by a password, which anonymous users have to unlock.
+	newProtectedSnippet := func(t *testing.T) (*testServer, *models.Snippet) {
+		app := newTestApplication(t)
+		newTestUsers(t, app)
+
+		input := newSnippetInput("An old silent pond")
+		input.Password = "correct horse"
+		snippet := insertSnippet(t, app, 1, input)
+
+		return newTestServer(t, app.routes()), snippet
+	}
+
+	// unlock posts a password to the unlock form of the snippet.
+	unlock := func(t *testing.T, ts *testServer, snippet *models.Snippet, password string) (int, http.Header, string) {
+		_, _, body := ts.get(t, snippetURL(snippet))
+
+		form := url.Values{}
+		form.Add("password", password)
+		form.Add("csrf_token", extractCSRFToken(t, body))
+
+		return ts.postForm(t, snippetURL(snippet)+"/unlock", form)
+	}
+
+	t.Run("Locked", func(t *testing.T) {
+		ts, snippet := newProtectedSnippet(t)
+
+		code, _, body := ts.get(t, snippetURL(snippet))
+		if code != http.StatusOK {
+			t.Errorf("got status %d; want %d", code, http.StatusOK)
+		}
+		if !strings.Contains(body, `name="password"`) || strings.Contains(body, snippet.Content) {
+			t.Errorf("got the snippet instead of the password prompt")
+		}
+
+		// The raw content is fetched by scripts, which are told in plain
+		// text to unlock the snippet rather than sent to the HTML prompt.
+		for _, path := range []string{
+			fmt.Sprintf("/snippet/raw/%d", snippet.ID),
+			fmt.Sprintf("/snippet/download/%d", snippet.ID),
+			snippetURL(snippet) + "/raw",
+			snippetURL(snippet) + "/download",
+		} {
+			code, header, body := ts.get(t, path)
+			if code != http.StatusForbidden {
+				t.Errorf("got status %d for %s; want %d", code, path, http.StatusForbidden)
+			}
+			if !strings.HasPrefix(header.Get("Content-Type"), "text/plain") {
+				t.Errorf("got content type %q for %s; want plain text", header.Get("Content-Type"), path)
+			}
+			if !strings.Contains(body, "Unlock it at "+snippetURL(snippet)) || strings.Contains(body, snippet.Content) {
+				t.Errorf("got body %q for %s; want a message telling to unlock the snippet", body, path)
+			}
+		}
+	})
+
+	t.Run("Wrong password", func(t *testing.T) {
+		ts, snippet := newProtectedSnippet(t)
+
+		code, _, body := unlock(t, ts, snippet, "wrong horse")
+		if code != http.StatusUnprocessableEntity {
+			t.Errorf("got status %d; want %d", code, http.StatusUnprocessableEntity)
+		}
+		if !strings.Contains(body, "Password is incorrect") {
+			t.Errorf("body doesn't contain the error message")
+		}
+
+		_, _, body = ts.get(t, snippetURL(snippet))
+		if strings.Contains(body, snippet.Content) {
+			t.Errorf("got the snippet after a wrong password")
+		}
+	})
+
+	t.Run("Too many attempts", func(t *testing.T) {
+		ts, snippet := newProtectedSnippet(t)
+
+		for i := 0; i < 5; i++ {
+			code, _, _ := unlock(t, ts, snippet, "wrong horse")
+			if code != http.StatusUnprocessableEntity {
+				t.Fatalf("got status %d for attempt %d; want %d", code, i+1, http.StatusUnprocessableEntity)
+			}
+		}
+
+		// Once the limit is reached, even the right password is refused.
+		code, _, body := unlock(t, ts, snippet, "correct horse")
+		if code != http.StatusTooManyRequests {
+			t.Errorf("got status %d; want %d", code, http.StatusTooManyRequests)
+		}
+		if !strings.Contains(body, "Too many incorrect passwords") {
+			t.Errorf("body doesn't contain the error message")
+		}
+	})
+
+	t.Run("Right password", func(t *testing.T) {
+		ts, snippet := newProtectedSnippet(t)
+
+		code, header, _ := unlock(t, ts, snippet, "correct horse")
+		if code != http.StatusSeeOther || header.Get("Location") != snippetURL(snippet) {
+			t.Fatalf("got status %d and location %q; want a redirect to %q", code, header.Get("Location"), snippetURL(snippet))
+		}
+
+		// The snippet stays unlocked for the rest of the session.
+		code, _, body := ts.get(t, snippetURL(snippet))
+		if code != http.StatusOK || !strings.Contains(body, snippet.Content) {
+			t.Errorf("got status %d without the snippet; want %d with it", code, http.StatusOK)
+		}
+
+		code, _, body = ts.get(t, fmt.Sprintf("/snippet/raw/%d", snippet.ID))
+		if code != http.StatusOK || body != snippet.Content {
+			t.Errorf("got status %d and body %q for the raw snippet; want %d and %q", code, body, http.StatusOK, snippet.Content)
+		}
+
+		// Another session still has to enter the password.
+		other := newTestServer(t, ts.Config.Handler)
+		_, _, body = other.get(t, snippetURL(snippet))
+		if strings.Contains(body, snippet.Content) {
+			t.Errorf("got the snippet in another session")
+		}
+	})
+}
+
+func TestSnippetRawBySlug(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	newTestUsers(t, app)
+
+	input := newSnippetInput("An old silent pond")
+	input.Visibility = models.VisibilityUnlisted
+	input.Filename = "pond.txt"
+	input.Files = []models.SnippetFile{{Filename: "frog.txt", Language: "plaintext", Content: "A frog jumps into the pond"}}
+	unlisted := insertSnippet(t, app, 1, input)
+
+	input = newSnippetInput("A new pond")
+	input.Visibility = models.VisibilityPrivate
+	private := insertSnippet(t, app, 1, input)
+
+	// The files of unlisted snippets are linked by their slug, because they
+	// can't be found by their ID.
+	_, _, body := ts.get(t, snippetURL(unlisted))
+	for _, href := range []string{snippetURL(unlisted) + "/raw/1", snippetURL(unlisted) + "/download/1"} {
+		if !strings.Contains(body, `href="`+href+`"`) {
+			t.Errorf("snippet page doesn't link to %s", href)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{"Raw", snippetURL(unlisted) + "/raw", http.StatusOK, unlisted.Content},
+		{"Raw file", snippetURL(unlisted) + "/raw/1", http.StatusOK, "A frog jumps into the pond"},
+		{"Download file", snippetURL(unlisted) + "/download/1", http.StatusOK, "A frog jumps into the pond"},
+		{"Missing file", snippetURL(unlisted) + "/raw/2", http.StatusNotFound, ""},
+		{"By ID", fmt.Sprintf("/snippet/raw/%d", unlisted.ID), http.StatusNotFound, ""},
+		{"Private", snippetURL(private) + "/raw", http.StatusNotFound, ""},
+		{"Unknown slug", "/s/xxxxxxxxxx/raw", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+			if tt.wantBody != "" && body != tt.wantBody {
+				t.Errorf("got body %q; want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetViewLinks(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	newTestUsers(t, app)
+
+	input := newSnippetInput("An old silent pond")
+	input.Visibility = models.VisibilityUnlisted
+	snippet := insertSnippet(t, app, 1, input)
+
+	// Unlisted snippets can only be found by their slug, so the pages about
+	// them must be linked by their slug too.
+	_, _, body := ts.get(t, snippetURL(snippet))
+	for _, href := range []string{
+		snippetURL(snippet) + "/raw",
+		snippetURL(snippet) + "/download",
+		snippetURL(snippet) + "/history",
+	} {
+		if !strings.Contains(body, `href="`+href+`"`) {
+			t.Errorf("snippet page doesn't link to %s", href)
+		}
+	}
+
+	code, _, _ := ts.get(t, fmt.Sprintf("/snippet/view/%d/history", snippet.ID))
+	if code != http.StatusNotFound {
+		t.Errorf("got status %d for the history by ID; want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestSnippetForkBySlug(t *testing.T) {
+	app := newTestApplication(t)
+	newTestUsers(t, app)
+
+	input := newSnippetInput("An old silent pond")
+	input.Visibility = models.VisibilityUnlisted
+	parent := insertSnippet(t, app, 1, input)
+
+	ts := newTestServer(t, app.routes())
+	ts.login(t, "bob@example.com", "pa$$word")
+
+	// Bob only knows the slug of Alice's unlisted snippet.
+	_, _, body := ts.get(t, snippetURL(parent))
+	if !strings.Contains(body, `href="`+snippetURL(parent)+`/fork"`) {
+		t.Errorf("snippet page doesn't link to %s/fork", snippetURL(parent))
+	}
+
+	code, _, _ := ts.get(t, fmt.Sprintf("/snippet/fork/%d", parent.ID))
+	if code != http.StatusNotFound {
+		t.Errorf("got status %d for the fork form by ID; want %d", code, http.StatusNotFound)
+	}
+
+	code, _, body = ts.get(t, snippetURL(parent)+"/fork")
+	if code != http.StatusOK {
+		t.Fatalf("got status %d for the fork form; want %d", code, http.StatusOK)
+	}
+	if !strings.Contains(body, `action="`+snippetURL(parent)+`/fork"`) {
+		t.Errorf("fork form doesn't post to %s/fork", snippetURL(parent))
+	}
+
+	code, header, _ := ts.postForm(t, snippetURL(parent)+"/fork", snippetFormValues("A new pond", extractCSRFToken(t, body)))
+	if code != http.StatusSeeOther {
+		t.Fatalf("got status %d for the fork; want %d", code, http.StatusSeeOther)
+	}
+
+	slug := strings.TrimPrefix(header.Get("Location"), "/s/")
+	fork, err := app.Snippets.GetBySlug(slug, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fork.UserID != 2 || !fork.ParentID.Valid || int(fork.ParentID.Int64) != parent.ID {
+		t.Errorf("got fork %+v; want one of Bob's with parent %d", fork, parent.ID)
+	}
+}
+
+func TestSnippetForkParentLink(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	newTestUsers(t, app)
+
+	tests := []struct {
+		name       string
+		visibility string
+		wantLink   bool
+	}{
+		{"Public", models.VisibilityPublic, true},
+		{"Unlisted", models.VisibilityUnlisted, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := newSnippetInput("An old silent pond")
+			input.Visibility = tt.visibility
+			parent := insertSnippet(t, app, 1, input)
+
+			id, err := app.Snippets.Fork(parent.ID, 2, newSnippetInput("A new pond"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fork, err := app.Snippets.Get(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The slug of an unlisted parent must not be shown to the
+			// readers of its forks.
+			_, _, body := ts.get(t, snippetURL(fork))
+			if !strings.Contains(body, fmt.Sprintf("#%d", parent.ID)) {
+				t.Errorf("fork page doesn't show its parent #%d", parent.ID)
+			}
+			if got := strings.Contains(body, `href="`+snippetURL(parent)+`"`); got != tt.wantLink {
+				t.Errorf("got link to the parent %t; want %t", got, tt.wantLink)
+			}
+			if !tt.wantLink && strings.Contains(body, parent.Slug) {
+				t.Errorf("fork page shows the slug of its unlisted parent")
+			}
+		})
+	}
+}
+
+func TestTagLinks(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	newTestUsers(t, app)
+
+	input := newSnippetInput("An old silent pond")
+	input.Tags = []string{"c#", "go"}
+	snippet := insertSnippet(t, app, 1, input)
+
+	// A # would start the fragment of the URL, so it must be escaped.
+	hrefRX := regexp.MustCompile(`href="(/tags/c[^"]*)"`)
+
+	for _, page := range []string{snippetURL(snippet), "/tags"} {
+		_, _, body := ts.get(t, page)
+
+		matches := hrefRX.FindStringSubmatch(body)
+		if matches == nil {
+			t.Fatalf("%s doesn't link to the c# tag", page)
+		}
+		if matches[1] != "/tags/c%23" {
+			t.Errorf("got link %q on %s; want %q", matches[1], page, "/tags/c%23")
+		}
+
+		code, _, body := ts.get(t, matches[1])
+		if code != http.StatusOK {
+			t.Errorf("got status %d following %q; want %d", code, matches[1], http.StatusOK)
+		}
+		if !strings.Contains(body, snippetURL(snippet)) {
+			t.Errorf("the page of the c# tag doesn't list the snippet")
+		}
+	}
+
+	code, _, _ := ts.get(t, "/tags/c")
+	if code != http.StatusNotFound {
+		t.Errorf("got status %d for an unused tag; want %d", code, http.StatusNotFound)
+	}
+}
@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"github.com/go-playground/form/v4"
 	"github.com/justinas/nosurf"
+	"github.com/liviu-moraru/snippetbox/internal/models"
 	"html/template"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -93,10 +95,12 @@ func (app *Application) render(w http.ResponseWriter, status int, page string, d
 // *http.Request parameter here at the moment, but we will do later in the book.
 func (app *Application) newTemplateData(r *http.Request) *templateData {
 	return &templateData{
-		CurrentYear:     time.Now().Year(),
-		Flash:           app.SessionManager.PopString(r.Context(), "flash"),
-		IsAuthenticated: app.isAuthenticated(r),
-		CSRFToken:       nosurf.Token(r), // Add the CSRF token.
+		CurrentYear:         time.Now().Year(),
+		Flash:               app.SessionManager.PopString(r.Context(), "flash"),
+		IsAuthenticated:     app.isAuthenticated(r),
+		CSRFToken:           nosurf.Token(r), // Add the CSRF token.
+		Languages:           supportedLanguages,
+		AuthenticatedUserID: app.authenticatedUserID(r),
 	}
 }
 
@@ -134,5 +138,78 @@ func (app *Application) decodePostForm(r *http.Request, dst any) error {
 // Return true if the current request is from an authenticated user, otherwise
 // return false.
 func (app *Application) isAuthenticated(r *http.Request) bool {
-	return app.SessionManager.Exists(r.Context(), "authenticatedUserID")
+	return app.authenticatedUser(r) != nil
+}
+
+// Return the user loaded into the request context by the authenticate
+// middleware, or nil if the request is not from an authenticated user.
+func (app *Application) authenticatedUser(r *http.Request) *models.User {
+	user, ok := r.Context().Value(authenticatedUserContextKey).(*models.User)
+	if !ok {
+		return nil
+	}
+	return user
+}
+
+// Return the ID of the authenticated user, or 0 if the request is not from an
+// authenticated user.
+func (app *Application) authenticatedUserID(r *http.Request) int {
+	if user := app.authenticatedUser(r); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+// The setPagination helper adds the pagination metadata to the template data,
+// together with the URLs of the previous and next pages. These keep all the
+// other query string parameters of the current request.
+func (app *Application) setPagination(data *templateData, r *http.Request, metadata models.Metadata) {
+	data.Metadata = metadata
+
+	pageURL := func(page int) string {
+		qs := r.URL.Query()
+		qs.Set("page", strconv.Itoa(page))
+		return r.URL.Path + "?" + qs.Encode()
+	}
+
+	if metadata.HasPrevious() {
+		data.PreviousPageURL = pageURL(metadata.CurrentPage - 1)
+	}
+	if metadata.HasNext() {
+		data.NextPageURL = pageURL(metadata.CurrentPage + 1)
+	}
+}
+
+// unlockedSnippetsKey is the session key holding the IDs of the
+// password-protected snippets unlocked in the session.
+const unlockedSnippetsKey = "unlockedSnippets"
+
+// The isUnlocked helper reports whether the user can read a snippet: either it
+// doesn't have a password, the user owns it, or its password has already been
+// entered in this session.
+func (app *Application) isUnlocked(r *http.Request, snippet *models.Snippet) bool {
+	if !snippet.Protected() || snippet.UserID == app.authenticatedUserID(r) {
+		return true
+	}
+
+	ids, _ := app.SessionManager.Get(r.Context(), unlockedSnippetsKey).([]int)
+	for _, id := range ids {
+		if id == snippet.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// The unlockSnippet helper records in the session that the password of a
+// snippet has been entered.
+func (app *Application) unlockSnippet(r *http.Request, id int) {
+	ids, _ := app.SessionManager.Get(r.Context(), unlockedSnippetsKey).([]int)
+	app.SessionManager.Put(r.Context(), unlockedSnippetsKey, append(ids, id))
+}
+
+// The passwordAttemptKey helper returns the key used to rate limit the
+// password attempts made by a client for a snippet.
+func passwordAttemptKey(r *http.Request, id int) string {
+	return fmt.Sprintf("%d:%s", id, clientIP(r))
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"html/template"
+)
+
+// supportedLanguages holds the values accepted for the language of a snippet.
+// Each of them is the name of a chroma lexer.
+var supportedLanguages = []string{
+	"plaintext", "bash", "c", "cpp", "css", "go", "html", "java", "javascript",
+	"json", "markdown", "python", "ruby", "rust", "sql", "typescript", "yaml",
+}
+
+// languageExtensions maps each supported language to the file extension used
+// when a snippet is downloaded.
+var languageExtensions = map[string]string{
+	"plaintext":  ".txt",
+	"bash":       ".sh",
+	"c":          ".c",
+	"cpp":        ".cpp",
+	"css":        ".css",
+	"go":         ".go",
+	"html":       ".html",
+	"java":       ".java",
+	"javascript": ".js",
+	"json":       ".json",
+	"markdown":   ".md",
+	"python":     ".py",
+	"ruby":       ".rb",
+	"rust":       ".rs",
+	"sql":        ".sql",
+	"typescript": ".ts",
+	"yaml":       ".yaml",
+}
+
+// The formatter emits CSS classes instead of inline styles, so that the
+// Content-Security-Policy set by secureHeaders doesn't have to allow
+// 'unsafe-inline'. The matching stylesheet is ui/static/css/highlight.css.
+var (
+	highlightFormatter = html.New(html.WithClasses(true))
+	highlightStyle     = styles.Get("github")
+)
+
+// Create a highlight function which renders the content of a snippet as HTML,
+// with syntax highlighting for its language. If the code can't be tokenised it
+// is shown as plain (escaped) text instead.
+func highlight(content string, language string) template.HTML {
+	lexer := lexers.Get(language)
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	iterator, err := lexer.Tokenise(nil, content)
+	if err == nil {
+		buf := new(bytes.Buffer)
+		err = highlightFormatter.Format(buf, highlightStyle, iterator)
+		if err == nil {
+			return template.HTML(buf.String())
+		}
+	}
+
+	return template.HTML("<pre><code>" + template.HTMLEscapeString(content) + "</code></pre>")
+}
@@ -9,31 +9,64 @@ import (
 	"github.com/go-playground/form/v4"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/liviu-moraru/snippetbox/config"
+	"github.com/liviu-moraru/snippetbox/internal/migrations"
 	"github.com/liviu-moraru/snippetbox/internal/models"
+	_ "github.com/mattn/go-sqlite3"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 )
 
 var cfg config.Configuration
 
+// The default and the usage of the -dsn flag, which is shared with the
+// migrate subcommand.
+const (
+	defaultDSN = "web:pass@/snippetbox?parseTime=true"
+	dsnUsage   = "Data source name: a MySQL DSN, a postgres:// URL, or sqlite:path for an SQLite database"
+)
+
 func main() {
 
+	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime|log.LUTC)
+	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.LUTC|log.Llongfile)
+
+	// The migrate subcommand manages the schema of the database and exits.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := runMigrate(os.Args[2:], os.Stdout)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		return
+	}
+
 	flag.StringVar(&cfg.Addr, "addr", ":4443", "HTTP network address")
 	flag.StringVar(&cfg.StaticDir, "static-dir", "./ui/static", "Path to static assets")
-	flag.StringVar(&cfg.DSN, "dsn", "web:pass@/snippetbox?parseTime=true", "MySQL data source name")
+	flag.StringVar(&cfg.DSN, "dsn", defaultDSN, dsnUsage)
+	flag.BoolVar(&cfg.Migrate, "migrate", false, "Apply the pending database migrations on startup")
 	flag.Parse()
 
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime|log.LUTC)
-	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.LUTC|log.Llongfile)
-
-	db, err := openDB(cfg.DSN)
+	db, dialect, err := openDB(cfg.DSN)
 	if err != nil {
 		errorLog.Fatal(err)
 	}
 	defer db.Close()
 
+	if cfg.Migrate {
+		migrator, err := migrations.New(db, dialect.String())
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		migrator.Log = infoLog
+
+		_, err = migrator.Up()
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
 	templateCache, err := newTemplateCache()
 	if err != nil {
 		errorLog.Fatal(err)
@@ -43,11 +76,11 @@ func main() {
 	formDecoder := form.NewDecoder()
 
 	// Use the scs.New() function to initialize a new session manager. Then we
-	// configure it to use our MySQL database as the session store, and set a
+	// configure it to use our database as the session store, and set a
 	// lifetime of 12 hours (so that sessions automatically expire 12 hours
 	// after first being created).
 	sessionManager := scs.New()
-	sessionManager.Store = mysqlstore.New(db)
+	sessionManager.Store = newSessionStore(db, dialect)
 	sessionManager.Lifetime = 12 * time.Hour
 	/*cookie := &sessionManager.Cookie
 	cookie.Name = "mySecondSession"
@@ -64,12 +97,17 @@ func main() {
 	app := &Application{
 		InfoLog:        infoLog,
 		ErrorLog:       errorLog,
-		Snippets:       &models.SnippetModel{DB: db},
-		Users:          &models.UserModel{DB: db},
+		Snippets:       &models.SnippetModel{DB: db, Dialect: dialect},
+		Revisions:      &models.SnippetRevisionModel{DB: db},
+		Tags:           &models.TagModel{DB: db},
+		Users:          &models.UserModel{DB: db, Dialect: dialect},
+		Tokens:         &models.TokenModel{DB: db},
 		StaticDir:      cfg.StaticDir,
 		TemplateCache:  templateCache,
 		FormDecoder:    formDecoder,
 		SessionManager: sessionManager,
+
+		PasswordAttempts: newAttemptLimiter(5, 15*time.Minute),
 	}
 
 	// Initialize a tls.Config struct to hold the non-default TLS settings we
@@ -102,13 +140,66 @@ func main() {
 
 }
 
-func openDB(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		return nil, err
+// parseDSN returns the database driver, the dialect of the models and the
+// driver's data source name for the -dsn flag. A DSN starting with sqlite:
+// (or sqlite3:) opens an SQLite database, with its foreign keys enforced, and
+// a postgres:// (or postgresql://) URL opens a Postgres database; anything
+// else is passed to the MySQL driver, with an optional mysql:// prefix
+// removed.
+func parseDSN(dsn string) (string, models.Dialect, string) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return "postgres", models.Postgres, dsn
+	}
+
+	for _, scheme := range []string{"sqlite:", "sqlite3:"} {
+		if strings.HasPrefix(dsn, scheme) {
+			dsn = strings.TrimPrefix(strings.TrimPrefix(dsn, scheme), "//")
+			if strings.Contains(dsn, "?") {
+				dsn += "&_foreign_keys=on"
+			} else {
+				dsn += "?_foreign_keys=on"
+			}
+			return "sqlite3", models.SQLite, dsn
+		}
+	}
+
+	return "mysql", models.MySQL, strings.TrimPrefix(dsn, "mysql://")
+}
+
+func openDB(dsn string) (*sql.DB, models.Dialect, error) {
+	driver, dialect, dsn := parseDSN(dsn)
+
+	var db *sql.DB
+	if dialect == models.Postgres {
+		connector, err := models.NewPostgresConnector(dsn)
+		if err != nil {
+			return nil, dialect, err
+		}
+		db = sql.OpenDB(connector)
+	} else {
+		var err error
+		db, err = sql.Open(driver, dsn)
+		if err != nil {
+			return nil, dialect, err
+		}
+	}
+	// SQLite lets one connection write at a time, and every connection to an
+	// in-memory database would open a new, empty one.
+	if dialect == models.SQLite {
+		db.SetMaxOpenConns(1)
 	}
-	if err = db.Ping(); err != nil {
-		return nil, err
+	if err := db.Ping(); err != nil {
+		return nil, dialect, err
+	}
+	return db, dialect, nil
+}
+
+// newSessionStore returns the scs store keeping the sessions in the sessions
+// table of the database. The models provide the store for SQLite and
+// Postgres.
+func newSessionStore(db *sql.DB, dialect models.Dialect) scs.Store {
+	if dialect == models.MySQL {
+		return mysqlstore.New(db)
 	}
-	return db, nil
+	return models.NewSessionStore(db, 5*time.Minute)
 }
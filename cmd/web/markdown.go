@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+	"html/template"
+	"regexp"
+)
+
+// The markdown converter supports GitHub Flavored Markdown. Raw HTML in the
+// source is left out, since goldmark isn't told that it is safe, and fenced
+// code blocks are highlighted like the snippets themselves.
+var markdownConverter = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(
+		renderer.WithNodeRenderers(util.Prioritized(&fencedCodeRenderer{}, 100)),
+	),
+)
+
+// The markdownPolicy is the allow-list applied to the rendered HTML, in case
+// goldmark lets anything through. It is the bluemonday policy for user
+// generated content, which adds rel="nofollow" to links, plus the classes
+// used by the highlighter and the disabled checkboxes of task lists.
+var markdownPolicy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^[a-z0-9 ]+$`)).OnElements("pre", "code", "span")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	return p
+}()
+
+// fencedCodeRenderer renders fenced code blocks with the highlight function,
+// using the language given after the opening fence.
+type fencedCodeRenderer struct{}
+
+func (r *fencedCodeRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, r.renderFencedCodeBlock)
+}
+
+func (r *fencedCodeRenderer) renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	n := node.(*ast.FencedCodeBlock)
+
+	var code bytes.Buffer
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		code.Write(line.Value(source))
+	}
+
+	_, err := w.WriteString(string(highlight(code.String(), string(n.Language(source)))))
+	return ast.WalkSkipChildren, err
+}
+
+// Create a markdown function which renders the content of a markdown snippet
+// as sanitized HTML.
+func markdown(content string) (template.HTML, error) {
+	var buf bytes.Buffer
+
+	err := markdownConverter.Convert([]byte(content), &buf)
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(markdownPolicy.SanitizeBytes(buf.Bytes())), nil
+}
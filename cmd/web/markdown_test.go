@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "Formatting",
+			content: "# Notes\n\nSome *emphasis* and a [link](https://example.com).",
+			want:    []string{"<h1", "<em>emphasis</em>", `href="https://example.com"`, `rel="nofollow"`},
+		},
+		{
+			name:    "Raw HTML",
+			content: "<script>alert(1)</script>\n\n<img src=x onerror=alert(1)>",
+			notWant: []string{"<script", "onerror", "alert(1)"},
+		},
+		{
+			name:    "Dangerous link",
+			content: "[click](javascript:alert(1))",
+			notWant: []string{"javascript:"},
+		},
+		{
+			name:    "Code fence",
+			content: "```go\nfmt.Println(\"<b>\")\n```",
+			want:    []string{`<pre class="chroma">`, `class="nx"`, "&lt;b&gt;"},
+			notWant: []string{"<b>", "style="},
+		},
+		{
+			name:    "Task list",
+			content: "- [x] done\n- [ ] todo",
+			want:    []string{`<input checked="" disabled="" type="checkbox"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, err := markdown(tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := string(html)
+
+			for _, s := range tt.want {
+				if !strings.Contains(got, s) {
+					t.Errorf("%q not found in %s", s, got)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(got, s) {
+					t.Errorf("%q found in %s", s, got)
+				}
+			}
+		})
+	}
+}
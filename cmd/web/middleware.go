@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/justinas/nosurf"
+	"github.com/liviu-moraru/snippetbox/internal/models"
 	"net/http"
+	"strings"
 )
 
 func secureHeaders(next http.Handler) http.Handler {
@@ -63,6 +67,104 @@ func (app *Application) requireAuthentication(next http.Handler) http.Handler {
 	})
 }
 
+// The authenticate middleware loads the user whose ID is stored in the session
+// and adds it to the request context. If the account has since been deleted or
+// disabled, the user is logged out straight away.
+func (app *Application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve the authenticatedUserID value from the session. If it isn't
+		// present then call the next handler in the chain as normal.
+		id := app.SessionManager.GetInt(r.Context(), "authenticatedUserID")
+		if id == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := app.Users.Get(id)
+		if err != nil {
+			if !errors.Is(err, models.ErrNoRecord) {
+				app.serverError(w, err)
+				return
+			}
+
+			// The account no longer exists (or has been disabled), so remove
+			// it from the session and carry on as an anonymous user.
+			err = app.SessionManager.RenewToken(r.Context())
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+			app.SessionManager.Remove(r.Context(), "authenticatedUserID")
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Otherwise, we know that the request is coming from an active user,
+		// so we create a new copy of the request with the user added to the
+		// request context and call the next handler with it.
+		ctx := context.WithValue(r.Context(), authenticatedUserContextKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// The authenticateAPI middleware is the JSON API counterpart of authenticate.
+// API clients have no session, so they identify themselves on every request
+// with a personal API token ("Authorization: Bearer <token>"). Passwords
+// aren't accepted: checking one costs a bcrypt hash, and the login form is the
+// only place where failed attempts are expected. Requests without credentials
+// carry on anonymously; requests with wrong credentials are rejected.
+func (app *Application) authenticateAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Responses vary depending on who is asking for them.
+		w.Header().Add("Vary", "Authorization")
+
+		authorizationHeader := r.Header.Get("Authorization")
+		if authorizationHeader == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scheme, token, _ := strings.Cut(authorizationHeader, " ")
+		if !strings.EqualFold(scheme, "Bearer") {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			app.apiErrorResponse(w, http.StatusUnauthorized, "unsupported authorization scheme, use a Bearer token")
+			return
+		}
+
+		user, err := app.Tokens.GetUser(token)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				app.apiErrorResponse(w, http.StatusUnauthorized, "invalid or revoked authentication token")
+			} else {
+				app.apiServerError(w, err)
+			}
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), authenticatedUserContextKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// The requireAPIAuthentication middleware works like requireAuthentication,
+// but answers with a 401 error envelope instead of redirecting to the login
+// page.
+func (app *Application) requireAPIAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isAuthenticated(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			app.apiErrorResponse(w, http.StatusUnauthorized, "you must be authenticated to access this resource")
+			return
+		}
+
+		w.Header().Add("Cache-Control", "no-store")
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // Create a NoSurf middleware function which uses a customized CSRF cookie with
 // the Secure, Path and HttpOnly attributes set.
 func noSurf(next http.Handler) http.Handler {
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/liviu-moraru/snippetbox/internal/migrations"
+	"io"
+	"log"
+	"strconv"
+	"text/tabwriter"
+)
+
+const migrateUsage = `Usage: web migrate [-dsn DSN] COMMAND
+
+Commands:
+  up                  apply all the pending migrations
+  down                revert the latest migration
+  status              list the migrations and when they were applied
+  to-version VERSION  apply or revert the migrations to reach VERSION;
+                      version 0 reverts them all
+  baseline VERSION    record the migrations up to VERSION as applied,
+                      without running them, to adopt a database whose
+                      schema was created before the migrations (version 5
+                      for the tables made by the old setup scripts)
+
+Flags:
+`
+
+// runMigrate runs the migrate subcommand with its arguments, writing its
+// output to w. With MySQL, the user in the DSN needs the privileges to
+// create, alter and drop tables, which the web user doesn't have.
+func runMigrate(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(w)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), migrateUsage)
+		flags.PrintDefaults()
+	}
+
+	dsn := flags.String("dsn", defaultDSN, dsnUsage)
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	command := flags.Arg(0)
+
+	var version int
+	switch {
+	case command == "up" || command == "down" || command == "status":
+		if flags.NArg() != 1 {
+			flags.Usage()
+			return fmt.Errorf("migrate %s: unexpected arguments", command)
+		}
+	case command == "to-version" || command == "baseline":
+		if flags.NArg() != 2 {
+			flags.Usage()
+			return fmt.Errorf("migrate %s: a version is required", command)
+		}
+		version, err = strconv.Atoi(flags.Arg(1))
+		if err != nil || version < 0 {
+			return fmt.Errorf("migrate %s: invalid version %q", command, flags.Arg(1))
+		}
+	default:
+		flags.Usage()
+		return fmt.Errorf("migrate: unknown command %q", command)
+	}
+
+	db, dialect, err := openDB(*dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrations.New(db, dialect.String())
+	if err != nil {
+		return err
+	}
+	migrator.Log = log.New(w, "", 0)
+
+	var n int
+	switch command {
+	case "up":
+		n, err = migrator.Up()
+	case "down":
+		n, err = migrator.Down()
+	case "to-version":
+		n, err = migrator.To(version)
+	case "baseline":
+		n, err = migrator.Baseline(version)
+	case "status":
+		return printMigrationStatus(w, migrator)
+	}
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		fmt.Fprintln(w, "no change")
+	}
+
+	current, err := migrator.Version()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "database at version %d\n", current)
+
+	return nil
+}
+
+// printMigrationStatus writes a table of the migrations, with the time each of
+// them was applied.
+func printMigrationStatus(w io.Writer, migrator *migrations.Migrator) error {
+	statuses, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+	for _, s := range statuses {
+		applied := "pending"
+		if s.Applied.Valid {
+			applied = s.Applied.Time.UTC().Format("2006-01-02 15:04:05 UTC")
+		}
+		fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunMigrate(t *testing.T) {
+	dsn := "sqlite:" + filepath.Join(t.TempDir(), "snippetbox.db")
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "Status before",
+			args: []string{"-dsn", dsn, "status"},
+			want: []string{"VERSION NAME APPLIED", "0001 create_users pending", "0006 create_snippet_revision_files pending"},
+		},
+		{
+			name: "Up",
+			args: []string{"-dsn", dsn, "up"},
+			want: []string{"applied migration 0001_create_users", "applied migration 0006_create_snippet_revision_files", "database at version 6"},
+		},
+		{
+			name: "Up again",
+			args: []string{"-dsn", dsn, "up"},
+			want: []string{"no change", "database at version 6"},
+		},
+		{
+			name: "Down",
+			args: []string{"-dsn", dsn, "down"},
+			want: []string{"reverted migration 0006_create_snippet_revision_files", "database at version 5"},
+		},
+		{
+			name: "To version",
+			args: []string{"-dsn", dsn, "to-version", "2"},
+			want: []string{"reverted migration 0005_create_sessions", "reverted migration 0003_create_tags", "database at version 2"},
+		},
+		{
+			name: "Status after",
+			args: []string{"-dsn", dsn, "status"},
+			want: []string{"0002 create_snippets 20", "0003 create_tags pending"},
+		},
+		{
+			name:    "Baseline a migrated database",
+			args:    []string{"-dsn", dsn, "baseline", "2"},
+			wantErr: true,
+		},
+		{
+			name:    "Baseline without a version",
+			args:    []string{"-dsn", dsn, "baseline"},
+			wantErr: true,
+		},
+		{
+			name:    "Unknown version",
+			args:    []string{"-dsn", dsn, "to-version", "99"},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid version",
+			args:    []string{"-dsn", dsn, "to-version", "two"},
+			wantErr: true,
+		},
+		{
+			name:    "Unknown command",
+			args:    []string{"-dsn", dsn, "sideways"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			err := runMigrate(tt.args, &out)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error; got output %q", out.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The columns of the status table are aligned with spaces.
+			var lines []string
+			for _, line := range strings.Split(out.String(), "\n") {
+				lines = append(lines, strings.Join(strings.Fields(line), " "))
+			}
+			got := strings.Join(lines, "\n")
+
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("output %q doesn't contain %q", got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxTrackedKeys is the number of keys an attemptLimiter holds before it
+// drops the windows which have already ended.
+const maxTrackedKeys = 10_000
+
+// attemptLimiter counts the failed attempts made for each key, and refuses
+// more attempts once there have been max failures within the window. Each
+// attempt is counted as a failure when it is allowed, until it is released.
+// It is a fixed window counter kept in memory, so the limits apply to each
+// process separately.
+type attemptLimiter struct {
+	mu       sync.Mutex
+	max      int
+	window   time.Duration
+	failures map[string]*failureWindow
+}
+
+// failureWindow holds the failures counted for a key since the window
+// started.
+type failureWindow struct {
+	count int
+	start time.Time
+}
+
+func newAttemptLimiter(max int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		max:      max,
+		window:   window,
+		failures: make(map[string]*failureWindow),
+	}
+}
+
+// The allow method reports whether another attempt can be made for the key,
+// and if so counts it as a failure straight away, under the same lock. This
+// way concurrent attempts can't all pass the check before any of them fails.
+// An attempt which turns out not to be a failure must be given back with
+// release.
+func (l *attemptLimiter) allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	f, ok := l.failures[key]
+	if ok && now.Sub(f.start) < l.window {
+		if f.count >= l.max {
+			return false
+		}
+		f.count++
+		return true
+	}
+
+	// Keys are only removed when they are used again, so clear out the old
+	// ones now and then to stop the map from growing without bounds.
+	if len(l.failures) >= maxTrackedKeys {
+		for k, f := range l.failures {
+			if now.Sub(f.start) >= l.window {
+				delete(l.failures, k)
+			}
+		}
+	}
+
+	l.failures[key] = &failureWindow{count: 1, start: now}
+	return true
+}
+
+// The release method gives back an attempt counted by allow, when it didn't
+// fail.
+func (l *attemptLimiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, ok := l.failures[key]
+	if !ok {
+		return
+	}
+
+	f.count--
+	if f.count <= 0 {
+		delete(l.failures, key)
+	}
+}
+
+// The clientIP helper returns the IP address of the client, without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
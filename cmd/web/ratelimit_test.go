@@ -0,0 +1,65 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAttemptLimiter(t *testing.T) {
+	l := newAttemptLimiter(3, time.Hour)
+
+	// Released attempts don't count as failures.
+	for i := 0; i < 5; i++ {
+		if !l.allow("a") {
+			t.Fatalf("released attempt %d refused", i+1)
+		}
+		l.release("a")
+	}
+
+	for i := 0; i < 3; i++ {
+		if !l.allow("a") {
+			t.Fatalf("attempt %d refused", i+1)
+		}
+	}
+
+	if l.allow("a") {
+		t.Error("attempt allowed after too many failures")
+	}
+	if !l.allow("b") {
+		t.Error("failures for one key limited another key")
+	}
+
+	// Once the window is over, attempts are allowed again.
+	l.failures["a"].start = time.Now().Add(-2 * time.Hour)
+	if !l.allow("a") {
+		t.Error("attempt refused after the window ended")
+	}
+}
+
+func TestAttemptLimiterConcurrent(t *testing.T) {
+	l := newAttemptLimiter(5, time.Hour)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if l.allow("a") {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 5 {
+		t.Errorf("got %d concurrent attempts allowed; want %d", allowed, 5)
+	}
+}
@@ -21,23 +21,67 @@ func (app *Application) routes() http.Handler {
 	// Leave the static files route unchanged.
 	router.Handler(http.MethodGet, "/static/*filepath", app.NoDirListingHandler(http.Dir(app.StaticDir)))
 
-	// Use the nosurf middleware on all our 'dynamic' routes.
-	dynamic := alice.New(app.SessionManager.LoadAndSave, noSurf)
+	// Use the nosurf middleware on all our 'dynamic' routes, and load the
+	// authenticated user (if any) into the request context.
+	dynamic := alice.New(app.SessionManager.LoadAndSave, noSurf, app.authenticate)
 
 	router.Handler(http.MethodGet, "/", dynamic.Then(app.HomeHandler()))
+	router.Handler(http.MethodGet, "/snippets", dynamic.ThenFunc(app.snippetList))
+	router.Handler(http.MethodGet, "/snippet/search", dynamic.ThenFunc(app.snippetSearch))
 	router.Handler(http.MethodGet, "/snippet/view/:id", dynamic.Then(app.SnippetViewHandler()))
+	router.Handler(http.MethodGet, "/snippet/raw/:id", dynamic.ThenFunc(app.snippetRaw))
+	router.Handler(http.MethodGet, "/snippet/download/:id", dynamic.ThenFunc(app.snippetDownload))
+	router.Handler(http.MethodGet, "/snippet/raw/:id/:file", dynamic.ThenFunc(app.snippetRaw))
+	router.Handler(http.MethodGet, "/snippet/download/:id/:file", dynamic.ThenFunc(app.snippetDownload))
+	router.Handler(http.MethodGet, "/snippet/view/:id/history", dynamic.ThenFunc(app.snippetHistory))
+	router.Handler(http.MethodGet, "/snippet/view/:id/diff", dynamic.ThenFunc(app.snippetDiff))
+	router.Handler(http.MethodGet, "/tags", dynamic.ThenFunc(app.tagList))
+	router.Handler(http.MethodGet, "/tags/:name", dynamic.ThenFunc(app.tagView))
+	router.Handler(http.MethodGet, "/s/:slug", dynamic.ThenFunc(app.snippetViewBySlug))
+	router.Handler(http.MethodPost, "/s/:slug", dynamic.ThenFunc(app.snippetBurnPost))
+	router.Handler(http.MethodPost, "/s/:slug/unlock", dynamic.ThenFunc(app.snippetUnlockPost))
+	router.Handler(http.MethodGet, "/s/:slug/raw", dynamic.ThenFunc(app.snippetRaw))
+	router.Handler(http.MethodGet, "/s/:slug/download", dynamic.ThenFunc(app.snippetDownload))
+	router.Handler(http.MethodGet, "/s/:slug/raw/:file", dynamic.ThenFunc(app.snippetRaw))
+	router.Handler(http.MethodGet, "/s/:slug/download/:file", dynamic.ThenFunc(app.snippetDownload))
+	router.Handler(http.MethodGet, "/s/:slug/history", dynamic.ThenFunc(app.snippetHistory))
+	router.Handler(http.MethodGet, "/s/:slug/diff", dynamic.ThenFunc(app.snippetDiff))
 	router.Handler(http.MethodGet, "/user/signup", dynamic.ThenFunc(app.userSignup))
 	router.Handler(http.MethodPost, "/user/signup", dynamic.ThenFunc(app.userSignupPost))
 	router.Handler(http.MethodGet, "/user/login", dynamic.ThenFunc(app.userLogin))
 	router.Handler(http.MethodPost, "/user/login", dynamic.ThenFunc(app.userLoginPost))
 
 	// Because the 'protected' middleware chain appends to the 'dynamic' chain
-	// the noSurf middleware will also be used on the three routes below too.
+	// the noSurf middleware will also be used on the routes below too.
 	protected := dynamic.Append(app.requireAuthentication)
 
 	router.Handler(http.MethodGet, "/snippet/create", protected.ThenFunc(app.snippetCreate))
 	router.Handler(http.MethodPost, "/snippet/create", protected.Then(app.SnippetCreatePostHandler()))
+	router.Handler(http.MethodPost, "/snippet/preview", protected.ThenFunc(app.snippetPreviewPost))
+	router.Handler(http.MethodGet, "/snippet/fork/:id", protected.ThenFunc(app.snippetFork))
+	router.Handler(http.MethodPost, "/snippet/fork/:id", protected.ThenFunc(app.snippetForkPost))
+	router.Handler(http.MethodGet, "/s/:slug/fork", protected.ThenFunc(app.snippetFork))
+	router.Handler(http.MethodPost, "/s/:slug/fork", protected.ThenFunc(app.snippetForkPost))
+	router.Handler(http.MethodGet, "/snippet/edit/:id", protected.ThenFunc(app.snippetEdit))
+	router.Handler(http.MethodPost, "/snippet/edit/:id", protected.ThenFunc(app.snippetEditPost))
+	router.Handler(http.MethodPost, "/snippet/delete/:id", protected.ThenFunc(app.snippetDeletePost))
+	router.Handler(http.MethodPost, "/snippet/view/:id/restore/:number", protected.ThenFunc(app.snippetRestorePost))
 	router.Handler(http.MethodPost, "/user/logout", protected.ThenFunc(app.userLogoutPost))
+	router.Handler(http.MethodGet, "/account/tokens", protected.ThenFunc(app.accountTokens))
+	router.Handler(http.MethodPost, "/account/tokens", protected.ThenFunc(app.accountTokensPost))
+	router.Handler(http.MethodPost, "/account/tokens/revoke/:id", protected.ThenFunc(app.accountTokenRevokePost))
+
+	// The JSON API doesn't use sessions, so it gets neither the session nor
+	// the nosurf middleware. Clients authenticate on every request instead.
+	api := alice.New(app.authenticateAPI)
+	apiProtected := api.Append(app.requireAPIAuthentication)
+
+	router.Handler(http.MethodGet, "/api/v1/snippets", api.ThenFunc(app.apiSnippetList))
+	router.Handler(http.MethodPost, "/api/v1/snippets", apiProtected.ThenFunc(app.apiSnippetCreate))
+	router.Handler(http.MethodGet, "/api/v1/snippets/:id", api.ThenFunc(app.apiSnippetGet))
+	router.Handler(http.MethodPost, "/api/v1/snippets/:id/burn", api.ThenFunc(app.apiSnippetBurn))
+	router.Handler(http.MethodPut, "/api/v1/snippets/:id", apiProtected.ThenFunc(app.apiSnippetUpdate))
+	router.Handler(http.MethodDelete, "/api/v1/snippets/:id", apiProtected.ThenFunc(app.apiSnippetDelete))
 
 	standard := alice.New(app.recoverPanic, app.logRequest, secureHeaders)
 	//standard := alice.New(app.logRequest, secureHeaders)
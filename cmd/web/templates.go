@@ -3,19 +3,33 @@ package main
 import (
 	"github.com/liviu-moraru/snippetbox/internal/models"
 	"html/template"
+	"net/url"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // Add a Form field with the type "any".
 type templateData struct {
-	CurrentYear     int
-	Snippet         *models.Snippet
-	Snippets        []*models.Snippet
-	Form            any
-	Flash           string // Add a flash field to the templateData struct
-	IsAuthenticated bool
-	CSRFToken       string // Add a CSRFToken field
+	CurrentYear         int
+	Snippet             *models.Snippet
+	Snippets            []*models.Snippet
+	Metadata            models.Metadata
+	PreviousPageURL     string
+	NextPageURL         string
+	Tokens              []*models.Token
+	Revisions           []*models.SnippetRevision
+	Tags                []*models.Tag
+	Diff                string
+	NewToken            string // The plain-text value of a just created token
+	Form                any
+	Flash               string // Add a flash field to the templateData struct
+	IsAuthenticated     bool
+	AuthenticatedUserID int    // 0 for anonymous requests
+	CSRFToken           string // Add a CSRFToken field
+	Languages           []string
 }
 
 // Create a humanDate function which returns a nicely formatted string
@@ -26,11 +40,96 @@ func humanDate(t time.Time) string {
 	return t.Format("02 Jan 06 15:04 -0700")
 }
 
+// Create a snippetURL function which returns the canonical address of a
+// snippet, based on its slug rather than its sequential id.
+func snippetURL(s *models.Snippet) string {
+	return "/s/" + s.Slug
+}
+
+// tagURL returns the path of the page of a tag. Tags can contain characters
+// like # which mean something else in a URL, so the name is escaped.
+func tagURL(name string) string {
+	return "/tags/" + url.PathEscape(name)
+}
+
+// searchTerms returns a case-insensitive regular expression matching any of the
+// words in a search query, or nil if there are none.
+func searchTerms(query string) *regexp.Regexp {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		terms = append(terms, regexp.QuoteMeta(word))
+	}
+	if len(terms) == 0 {
+		return nil
+	}
+	return regexp.MustCompile("(?i)" + strings.Join(terms, "|"))
+}
+
+// Create a markMatches function which HTML escapes the text and wraps every
+// occurrence of the words of the search query in a <mark> element. As the
+// result is trusted by html/template, everything else must be escaped here.
+func markMatches(text string, query string) template.HTML {
+	rx := searchTerms(query)
+	if rx == nil {
+		return template.HTML(template.HTMLEscapeString(text))
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, loc := range rx.FindAllStringIndex(text, -1) {
+		b.WriteString(template.HTMLEscapeString(text[last:loc[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(template.HTMLEscapeString(text[loc[0]:loc[1]]))
+		b.WriteString("</mark>")
+		last = loc[1]
+	}
+	b.WriteString(template.HTMLEscapeString(text[last:]))
+
+	return template.HTML(b.String())
+}
+
+// Create an excerpt function which returns about n characters of the text,
+// centred on the first match of the search query.
+func excerpt(text string, query string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+
+	start := 0
+	if rx := searchTerms(query); rx != nil {
+		if loc := rx.FindStringIndex(text); loc != nil {
+			start = utf8.RuneCountInString(text[:loc[0]]) - n/2
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > len(runes)-n {
+		start = len(runes) - n
+	}
+
+	s := string(runes[start : start+n])
+	if start > 0 {
+		s = "…" + s
+	}
+	if start+n < len(runes) {
+		s = s + "…"
+	}
+	return s
+}
+
 // Initialize a template.FuncMap object and store it in a global variable. This is
 // essentially a string-keyed map which acts as a lookup between the names of our
 // custom template functions and the functions themselves.
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"humanDate":   humanDate,
+	"markMatches": markMatches,
+	"excerpt":     excerpt,
+	"highlight":   highlight,
+	"markdown":    markdown,
+	"snippetURL":  snippetURL,
+	"tagURL":      tagURL,
 }
 
 func newTemplateCache() (map[string]*template.Template, error) {
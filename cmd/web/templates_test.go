@@ -0,0 +1,69 @@
+package main
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+)
+
+func TestMarkMatches(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		query string
+		want  template.HTML
+	}{
+		{"No query", "An old <silent> pond", "", "An old &lt;silent&gt; pond"},
+		{"Case insensitive", "An old silent pond", "OLD", "An <mark>old</mark> silent pond"},
+		{"Several words", "An old silent pond", "pond old", "An <mark>old</mark> silent <mark>pond</mark>"},
+		{"Escapes matches", "if a < b {", "<", "if a <mark>&lt;</mark> b {"},
+		{"Regexp characters", "f(x) + g(x)", "(x)", "f<mark>(x)</mark> + g<mark>(x)</mark>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := markMatches(tt.text, tt.query)
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	text := "aaaaaaaaaa frog bbbbbbbbbb"
+
+	if got := excerpt(text, "frog", 100); got != text {
+		t.Errorf("short text changed: %q", got)
+	}
+
+	if got := excerpt(text, "frog", 8); got != "…aaa frog…" {
+		t.Errorf("got %q", got)
+	}
+
+	if got := excerpt(text, "", 5); got != "aaaaa…" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	got := string(highlight(`fmt.Println("<b>")`, "go"))
+
+	// The content must be escaped, and must only be styled with classes so
+	// that no inline styles are needed under the Content-Security-Policy.
+	if strings.Contains(got, "<b>") {
+		t.Errorf("content not escaped: %s", got)
+	}
+	if strings.Contains(got, "style=") {
+		t.Errorf("inline style found: %s", got)
+	}
+	if !strings.Contains(got, `class="chroma"`) {
+		t.Errorf("missing chroma class: %s", got)
+	}
+
+	// Unknown languages still render the content.
+	got = string(highlight("a < b", "no-such-language"))
+	if !strings.Contains(got, "a &lt; b") {
+		t.Errorf("unexpected output: %s", got)
+	}
+}
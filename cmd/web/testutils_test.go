@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-playground/form/v4"
+	"github.com/liviu-moraru/snippetbox/internal/models"
+	"github.com/liviu-moraru/snippetbox/internal/models/mocks"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain runs the tests from the root of the repository, where the
+// application finds its templates and static files.
+func TestMain(m *testing.M) {
+	err := os.Chdir("../..")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// newTestApplication returns an instance of our application struct with the
+// in-memory snippet, tag, user and token models, and loggers which discard
+// everything.
+// The other models are left out, so the handlers using them can't be
+// tested this way.
+func newTestApplication(t *testing.T) *Application {
+	t.Helper()
+
+	templateCache, err := newTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The session manager keeps the sessions in memory, as it does by
+	// default, and sends secure cookies like the real one.
+	sessionManager := scs.New()
+	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.Cookie.Secure = true
+
+	users := &mocks.UserModel{}
+	snippets := &mocks.SnippetModel{Users: users}
+
+	return &Application{
+		InfoLog:          log.New(io.Discard, "", 0),
+		ErrorLog:         log.New(io.Discard, "", 0),
+		Snippets:         snippets,
+		Tags:             &mocks.TagModel{Snippets: snippets},
+		Users:            users,
+		Tokens:           &mocks.TokenModel{Users: users},
+		StaticDir:        "./ui/static",
+		TemplateCache:    templateCache,
+		FormDecoder:      form.NewDecoder(),
+		SessionManager:   sessionManager,
+		PasswordAttempts: newAttemptLimiter(5, 15*time.Minute),
+	}
+}
+
+// testServer Define a custom testServer type which embeds a httptest.Server
+// instance.
+type testServer struct {
+	*httptest.Server
+}
+
+// newTestServer starts a TLS test server for the routes of the application.
+// Its client keeps the cookies, so that the session and CSRF cookies are
+// sent back, and doesn't follow redirects, so that they can be checked.
+func newTestServer(t *testing.T, h http.Handler) *testServer {
+	t.Helper()
+
+	ts := httptest.NewTLSServer(h)
+	t.Cleanup(ts.Close)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Client().Jar = jar
+
+	ts.Client().CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &testServer{ts}
+}
+
+// get makes a GET request to a path on the test server, and returns the
+// response status code, headers and body.
+func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, string) {
+	t.Helper()
+
+	rs, err := ts.Client().Get(ts.URL + urlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, string(bytes.TrimSpace(body))
+}
+
+// postForm makes a POST request with form data to a path on the test server,
+// and returns the response status code, headers and body.
+func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (int, http.Header, string) {
+	t.Helper()
+
+	rs, err := ts.Client().PostForm(ts.URL+urlPath, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, string(bytes.TrimSpace(body))
+}
+
+// request makes a request with any method, headers and body to a path on the
+// test server, for the JSON API, and returns the response status code,
+// headers and body.
+func (ts *testServer) request(t *testing.T, method string, urlPath string, header http.Header, body string) (int, http.Header, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, ts.URL+urlPath, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	respBody, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, string(bytes.TrimSpace(respBody))
+}
+
+// csrfTokenRX captures the CSRF token from the hidden field of our forms.
+var csrfTokenRX = regexp.MustCompile(`<input type="hidden" name="csrf_token" value="(.+?)">`)
+
+// extractCSRFToken returns the CSRF token of the first form in a page.
+func extractCSRFToken(t *testing.T, body string) string {
+	t.Helper()
+
+	matches := csrfTokenRX.FindStringSubmatch(body)
+	if len(matches) < 2 {
+		t.Fatal("no csrf token found in body")
+	}
+
+	return html.UnescapeString(matches[1])
+}
+
+// login signs a user in through the login form, and fails the test if the
+// login doesn't succeed.
+func (ts *testServer) login(t *testing.T, email string, password string) {
+	t.Helper()
+
+	_, _, body := ts.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", password)
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("login as %s: got status %d; want %d", email, code, http.StatusSeeOther)
+	}
+}
+
+// newTestUsers adds Alice, whose ID is 1, and Bob, whose ID is 2, to the users
+// of the application. Both have the password "pa$$word".
+func newTestUsers(t *testing.T, app *Application) {
+	t.Helper()
+
+	for _, u := range []struct{ name, email string }{
+		{"Alice Jones", "alice@example.com"},
+		{"Bob Smith", "bob@example.com"},
+	} {
+		err := app.Users.Insert(u.name, u.email, "pa$$word")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// insertSnippet adds a snippet owned by a user, and returns it as stored.
+func insertSnippet(t *testing.T, app *Application, userID int, input models.SnippetInput) *models.Snippet {
+	t.Helper()
+
+	id, err := app.Snippets.Insert(userID, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := app.Snippets.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// newSnippetInput returns the values of a public plain text snippet which
+// expires in a day.
+func newSnippetInput(title string) models.SnippetInput {
+	return models.SnippetInput{
+		Title:      title,
+		Content:    "An old silent pond...",
+		Language:   "plaintext",
+		Format:     models.FormatPlain,
+		Visibility: models.VisibilityPublic,
+		Expires:    sql.NullTime{Time: time.Now().Add(24 * time.Hour), Valid: true},
+	}
+}
+
+// snippetFormValues returns the fields of a valid snippet form.
+func snippetFormValues(title string, csrfToken string) url.Values {
+	form := url.Values{}
+	form.Add("title", title)
+	form.Add("content", "An old silent pond...")
+	form.Add("language", "plaintext")
+	form.Add("format", "plain")
+	form.Add("visibility", "public")
+	form.Add("expires", "7d")
+	form.Add("csrf_token", csrfToken)
+	return form
+}
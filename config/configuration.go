@@ -4,4 +4,5 @@ type Configuration struct {
 	Addr      string
 	StaticDir string
 	DSN       string
+	Migrate   bool
 }
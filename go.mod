@@ -4,15 +4,25 @@ go 1.18
 
 require (
 	github.com/DATA-DOG/go-sqlmock v1.5.0
+	github.com/alecthomas/chroma/v2 v2.2.0
+	github.com/alexedwards/scs/mysqlstore v0.0.0-20220528130143-d93ace5be94b
+	github.com/alexedwards/scs/v2 v2.5.0
+	github.com/go-playground/form/v4 v4.2.0
 	github.com/go-sql-driver/mysql v1.6.0
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/justinas/alice v1.2.0
+	github.com/justinas/nosurf v1.1.1
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.15
+	github.com/microcosm-cc/bluemonday v1.0.24
+	github.com/pmezard/go-difflib v1.0.0
+	github.com/yuin/goldmark v1.4.12
+	golang.org/x/crypto v0.10.0
 )
 
 require (
-	github.com/alexedwards/scs/mysqlstore v0.0.0-20220528130143-d93ace5be94b // indirect
-	github.com/alexedwards/scs/v2 v2.5.0 // indirect
-	github.com/go-playground/form/v4 v4.2.0 // indirect
-	github.com/justinas/nosurf v1.1.1 // indirect
-	golang.org/x/crypto v0.0.0-20220919173607-35f4265a4bc0 // indirect
+	github.com/aymerick/douceur v0.2.0 // indirect
+	github.com/dlclark/regexp2 v1.4.0 // indirect
+	github.com/gorilla/css v1.0.0 // indirect
+	golang.org/x/net v0.11.0 // indirect
 )
@@ -0,0 +1,416 @@
+// Package migrations holds the versioned schema of the snippetbox database,
+// embedded in the binary, and applies it to a database.
+//
+// Every dialect has a directory of migrations named like
+// 0001_create_users.up.sql and 0001_create_users.down.sql. The up file moves
+// the schema to the version and the down file moves it back. The versions
+// applied to a database are recorded in its schema_migrations table.
+//
+// The up files create their tables unconditionally, so that applying them to a
+// database which already has a table of the same name fails, rather than
+// silently keeping a schema that may not match. Databases created before the
+// migrations, by the old setup scripts, are adopted with Baseline instead.
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed mysql/*.sql sqlite/*.sql postgres/*.sql
+var files embed.FS
+
+var (
+	ErrUnknownDialect = errors.New("migrations: unknown dialect")
+	ErrUnknownVersion = errors.New("migrations: unknown version")
+)
+
+// filenameRX matches the names of the migration files, and statementEndRX the
+// semicolons ending their statements.
+var (
+	filenameRX     = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+	statementEndRX = regexp.MustCompile(`;\s*(\n|$)`)
+)
+
+// Migration Define a Migration type to hold the statements moving the schema to
+// a version and back.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status Define a Status type to tell whether a migration has been applied,
+// and when.
+type Status struct {
+	*Migration
+	Applied sql.NullTime
+}
+
+// Migrator Define a Migrator type which applies the migrations of a dialect to
+// a database. The dialect is the name of a directory of migrations: mysql,
+// sqlite or postgres. If Log is set, every migration applied or reverted is
+// logged to it.
+type Migrator struct {
+	DB         *sql.DB
+	Dialect    string
+	Migrations []*Migration
+	Log        *log.Logger
+}
+
+// New returns a Migrator with the embedded migrations of a dialect.
+func New(db *sql.DB, dialect string) (*Migrator, error) {
+	migrations, err := load(files, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{DB: db, Dialect: dialect, Migrations: migrations}, nil
+}
+
+// load reads the migrations in a directory, ordered by version. Every version
+// needs both an up and a down file.
+func load(fsys fs.FS, dir string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w %q", ErrUnknownDialect, dir)
+		}
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+
+	for _, entry := range entries {
+		matches := filenameRX.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			continue
+		}
+
+		version, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		}
+		if m.Name != matches[2] {
+			return nil, fmt.Errorf("migrations: version %d is used by %s and %s", version, m.Name, matches[2])
+		}
+
+		b, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		if matches[3] == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migrations: version %d (%s) needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Statements splits a SQL script, such as a migration file, into its
+// statements, which end with a semicolon at the end of a line. They are run
+// one at a time, since not every driver accepts several statements in one
+// call.
+func Statements(content string) []string {
+	var stmts []string
+	for _, stmt := range statementEndRX.Split(content, -1) {
+		if strings.TrimSpace(stmt) != "" {
+			stmts = append(stmts, strings.TrimSpace(stmt))
+		}
+	}
+	return stmts
+}
+
+// createTable creates the schema_migrations table if it doesn't exist yet.
+func (m *Migrator) createTable() error {
+	timestamp := "DATETIME"
+	if m.Dialect == "postgres" {
+		timestamp = "TIMESTAMP"
+	}
+
+	_, err := m.DB.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER NOT NULL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	applied ` + timestamp + ` NOT NULL)`)
+	return err
+}
+
+// applied returns when each of the applied versions was applied.
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	err := m.createTable()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.Query(`SELECT version, applied FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var t time.Time
+		err := rows.Scan(&version, &t)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = t
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+// Version returns the latest version applied to the database, or 0 if there
+// is none.
+func (m *Migrator) Version() (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	version := 0
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+// Status returns every migration, in order, with the time it was applied.
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.Migrations))
+	for _, migration := range m.Migrations {
+		t, ok := applied[migration.Version]
+		statuses = append(statuses, Status{Migration: migration, Applied: sql.NullTime{Time: t, Valid: ok}})
+	}
+	return statuses, nil
+}
+
+// Up applies all the migrations which haven't been applied yet, and returns
+// how many there were.
+func (m *Migrator) Up() (int, error) {
+	if len(m.Migrations) == 0 {
+		return 0, nil
+	}
+	return m.To(m.Migrations[len(m.Migrations)-1].Version)
+}
+
+// Down reverts the latest migration applied, and returns how many migrations
+// were reverted: 1, or 0 if none had been applied.
+func (m *Migrator) Down() (int, error) {
+	version, err := m.Version()
+	if err != nil || version == 0 {
+		return 0, err
+	}
+
+	migration := m.find(version)
+	if migration == nil {
+		return 0, fmt.Errorf("migrations: can't revert version %d, which this binary doesn't know about", version)
+	}
+
+	err = m.run(migration, false)
+	if err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// To applies the migrations up to a version and reverts the ones after it,
+// newest first, and returns how many migrations were run. Version 0 reverts
+// them all. Each migration runs in its own transaction; note that MySQL
+// commits the changes to the schema straight away, so a migration which
+// fails there may be left half-applied.
+func (m *Migrator) To(version int) (int, error) {
+	if version != 0 && m.find(version) == nil {
+		return 0, fmt.Errorf("%w %d", ErrUnknownVersion, version)
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	for v := range applied {
+		if v > version && m.find(v) == nil {
+			return 0, fmt.Errorf("migrations: can't revert version %d, which this binary doesn't know about", v)
+		}
+	}
+
+	count := 0
+
+	for _, migration := range m.Migrations {
+		if _, ok := applied[migration.Version]; migration.Version <= version && !ok {
+			err := m.run(migration, true)
+			if err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+
+	for i := len(m.Migrations) - 1; i >= 0; i-- {
+		migration := m.Migrations[i]
+		if _, ok := applied[migration.Version]; migration.Version > version && ok {
+			err := m.run(migration, false)
+			if err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Baseline records the migrations up to a version as applied, without running
+// them, and returns how many were recorded. It adopts a database whose schema
+// was created without the migrations, and which must already match that
+// version; the later migrations can then be applied with Up. It refuses to
+// change a database where migrations have already been applied.
+func (m *Migrator) Baseline(version int) (int, error) {
+	if m.find(version) == nil {
+		return 0, fmt.Errorf("%w %d", ErrUnknownVersion, version)
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+	if len(applied) > 0 {
+		return 0, errors.New("migrations: can't baseline a database where migrations have been applied")
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	// The rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	var baselined []*Migration
+	for _, migration := range m.Migrations {
+		if migration.Version > version {
+			break
+		}
+
+		_, err := tx.Exec(`INSERT INTO schema_migrations (version, name, applied) VALUES (?, ?, ?)`,
+			migration.Version, migration.Name, time.Now().UTC())
+		if err != nil {
+			return 0, err
+		}
+		baselined = append(baselined, migration)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	if m.Log != nil {
+		for _, migration := range baselined {
+			m.Log.Printf("recorded migration %04d_%s as applied", migration.Version, migration.Name)
+		}
+	}
+
+	return len(baselined), nil
+}
+
+func (m *Migrator) find(version int) *Migration {
+	for _, migration := range m.Migrations {
+		if migration.Version == version {
+			return migration
+		}
+	}
+	return nil
+}
+
+// run applies a migration, or reverts it, and records the change in the
+// schema_migrations table.
+func (m *Migrator) run(migration *Migration, up bool) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	// The rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	content, action := migration.Up, "applied"
+	if !up {
+		content, action = migration.Down, "reverted"
+	}
+
+	for _, stmt := range Statements(content) {
+		_, err := tx.Exec(stmt)
+		if err != nil {
+			return fmt.Errorf("migrations: version %d (%s): %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	if up {
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version, name, applied) VALUES (?, ?, ?)`,
+			migration.Version, migration.Name, time.Now().UTC())
+	} else {
+		_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, migration.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	if m.Log != nil {
+		m.Log.Printf("%s migration %04d_%s", action, migration.Version, migration.Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,282 @@
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	_ "github.com/mattn/go-sqlite3"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func newTestMigrator(t *testing.T) *Migrator {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:?_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: opens a different database.
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	m, err := New(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS(SELECT true FROM sqlite_master WHERE type = 'table' AND name = ?)`, name).Scan(&exists)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exists
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	var want []int
+
+	for _, dialect := range []string{"mysql", "sqlite", "postgres"} {
+		migrations, err := load(files, dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var versions []int
+		for _, m := range migrations {
+			versions = append(versions, m.Version)
+		}
+
+		if want == nil {
+			want = versions
+		}
+		if !reflect.DeepEqual(versions, want) {
+			t.Errorf("%s has versions %v; want %v", dialect, versions, want)
+		}
+	}
+
+	_, err := load(files, "oracle")
+	if !errors.Is(err, ErrUnknownDialect) {
+		t.Errorf("got error %v; want ErrUnknownDialect", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"db/0002_second.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER);")},
+		"db/0002_second.down.sql": {Data: []byte("DROP TABLE b;")},
+		"db/0001_first.up.sql":    {Data: []byte("CREATE TABLE a (id INTEGER);")},
+		"db/0001_first.down.sql":  {Data: []byte("DROP TABLE a;")},
+		"db/README":               {Data: []byte("Not a migration")},
+	}
+
+	migrations, err := load(fsys, "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 || migrations[0].Name != "first" || migrations[1].Name != "second" {
+		t.Fatalf("unexpected migrations %+v", migrations)
+	}
+
+	delete(fsys, "db/0002_second.down.sql")
+	_, err = load(fsys, "db")
+	if err == nil {
+		t.Error("a migration without a down file was loaded")
+	}
+}
+
+func TestStatements(t *testing.T) {
+	content := "-- Create the table.\nCREATE TABLE a (\n    id INTEGER\n);\n\nCREATE INDEX a_idx ON a(id);\n"
+
+	got := Statements(content)
+	want := []string{"-- Create the table.\nCREATE TABLE a (\n    id INTEGER\n)", "CREATE INDEX a_idx ON a(id)"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	m := newTestMigrator(t)
+	latest := m.Migrations[len(m.Migrations)-1].Version
+
+	n, err := m.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(m.Migrations) {
+		t.Errorf("applied %d migrations; want %d", n, len(m.Migrations))
+	}
+	if !tableExists(t, m.DB, "snippets") || !tableExists(t, m.DB, "sessions") {
+		t.Error("the tables weren't created")
+	}
+
+	n, err = m.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("applied %d migrations twice", n)
+	}
+
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if !s.Applied.Valid {
+			t.Errorf("migration %d isn't applied", s.Version)
+		}
+	}
+
+	n, err = m.Down()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("reverted %d migrations; want 1", n)
+	}
+
+	version, err := m.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != latest-1 {
+		t.Errorf("got version %d; want %d", version, latest-1)
+	}
+
+	_, err = m.To(latest + 1)
+	if !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("got error %v; want ErrUnknownVersion", err)
+	}
+
+	_, err = m.To(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tableExists(t, m.DB, "users") {
+		t.Error("the users table wasn't dropped")
+	}
+
+	n, err = m.Down()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("reverted %d migrations from version 0", n)
+	}
+
+	n, err = m.To(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || !tableExists(t, m.DB, "snippets") || tableExists(t, m.DB, "tags") {
+		t.Errorf("applied %d migrations migrating to version 2", n)
+	}
+}
+
+func TestMigratorBaseline(t *testing.T) {
+	m := newTestMigrator(t)
+
+	// Create the tables of version 2 and forget about it, like a database set
+	// up without the migrations.
+	_, err := m.To(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.DB.Exec(`DELETE FROM schema_migrations`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The migrations refuse to create the tables again.
+	_, err = m.Up()
+	if err == nil {
+		t.Fatal("applied the migrations over the existing tables")
+	}
+
+	_, err = m.Baseline(99)
+	if !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("got error %v; want ErrUnknownVersion", err)
+	}
+
+	n, err := m.Baseline(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("recorded %d migrations; want 2", n)
+	}
+
+	_, err = m.Baseline(2)
+	if err == nil {
+		t.Error("baselined a database twice")
+	}
+
+	n, err = m.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(m.Migrations)-2 || !tableExists(t, m.DB, "tags") {
+		t.Errorf("applied %d migrations after the baseline; want %d", n, len(m.Migrations)-2)
+	}
+}
+
+func TestMigrationRevisionFiles(t *testing.T) {
+	m := newTestMigrator(t)
+
+	_, err := m.To(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A snippet with an extra file and two revisions, saved before the files
+	// were versioned.
+	for _, stmt := range []string{
+		`INSERT INTO users (name, email, hashed_password, created) VALUES ('Alice', 'alice@example.com', 'x', '2022-01-01')`,
+		`INSERT INTO snippets (user_id, slug, title, content, filename, created) VALUES (1, 'pond', 'Pond', 'An old silent pond', 'pond.txt', '2022-01-01')`,
+		`INSERT INTO snippet_files (snippet_id, position, filename, language, content) VALUES (1, 1, 'frog.txt', 'plaintext', 'A frog jumps')`,
+		`INSERT INTO snippet_revisions (snippet_id, number, user_id, title, content, language, created) VALUES (1, 1, 1, 'Pond', 'An old', 'plaintext', '2022-01-01')`,
+		`INSERT INTO snippet_revisions (snippet_id, number, user_id, title, content, language, created) VALUES (1, 2, 1, 'Pond', 'An old silent pond', 'plaintext', '2022-01-02')`,
+	} {
+		_, err := m.DB.Exec(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = m.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the latest revision is known to match the current files.
+	rows, err := m.DB.Query(`SELECT r.number, r.filename, COUNT(f.id) FROM snippet_revisions r
+	LEFT JOIN snippet_revision_files f ON f.revision_id = r.id GROUP BY r.id ORDER BY r.number`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var got []string
+	for rows.Next() {
+		var number, files int
+		var filename string
+		err := rows.Scan(&number, &filename, &files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%d %q %d", number, filename, files))
+	}
+
+	want := []string{`1 "" 0`, `2 "pond.txt" 1`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got revisions %v; want %v", got, want)
+	}
+}
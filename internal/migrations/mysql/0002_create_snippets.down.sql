@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS snippet_files;
+DROP TABLE IF EXISTS snippet_revisions;
+DROP TABLE IF EXISTS snippets;
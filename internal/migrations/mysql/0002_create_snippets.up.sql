@@ -0,0 +1,49 @@
+CREATE TABLE snippets (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    parent_id INTEGER NULL,
+    slug VARCHAR(32) NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    language VARCHAR(32) NOT NULL DEFAULT 'plaintext',
+    format VARCHAR(16) NOT NULL DEFAULT 'plain',
+    filename VARCHAR(100) NOT NULL DEFAULT '',
+    visibility ENUM('public', 'unlisted', 'private') NOT NULL DEFAULT 'public',
+    created DATETIME NOT NULL,
+    expires DATETIME NULL,
+    burn_after_reading BOOLEAN NOT NULL DEFAULT FALSE,
+    password_hash CHAR(60) NULL,
+    encrypted BOOLEAN NOT NULL DEFAULT FALSE,
+    INDEX idx_snippets_created (created),
+    FULLTEXT INDEX idx_snippets_fulltext (title, content),
+    CONSTRAINT snippets_uc_slug UNIQUE (slug),
+    CONSTRAINT fk_snippets_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_snippets_parent FOREIGN KEY (parent_id) REFERENCES snippets(id) ON DELETE SET NULL
+);
+
+CREATE TABLE snippet_revisions (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    number INTEGER NOT NULL,
+    user_id INTEGER,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    language VARCHAR(32) NOT NULL,
+    format VARCHAR(16) NOT NULL DEFAULT 'plain',
+    encrypted BOOLEAN NOT NULL DEFAULT FALSE,
+    created DATETIME NOT NULL,
+    CONSTRAINT snippet_revisions_uc_number UNIQUE (snippet_id, number),
+    CONSTRAINT fk_snippet_revisions_snippet FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE,
+    CONSTRAINT fk_snippet_revisions_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE snippet_files (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    filename VARCHAR(100) NOT NULL,
+    language VARCHAR(32) NOT NULL,
+    content TEXT NOT NULL,
+    CONSTRAINT snippet_files_uc_position UNIQUE (snippet_id, position),
+    CONSTRAINT fk_snippet_files_snippet FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE
+);
@@ -0,0 +1,24 @@
+ALTER TABLE snippet_revisions ADD COLUMN filename VARCHAR(100) NOT NULL DEFAULT '';
+
+CREATE TABLE snippet_revision_files (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    revision_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    filename VARCHAR(100) NOT NULL,
+    language VARCHAR(32) NOT NULL,
+    content TEXT NOT NULL,
+    CONSTRAINT snippet_revision_files_uc_position UNIQUE (revision_id, position),
+    CONSTRAINT fk_snippet_revision_files_revision FOREIGN KEY (revision_id) REFERENCES snippet_revisions(id) ON DELETE CASCADE
+);
+
+-- Only the current files of the snippets are known, so they are copied into their latest revisions.
+UPDATE snippet_revisions r
+    INNER JOIN snippets s ON s.id = r.snippet_id
+    INNER JOIN (SELECT snippet_id, MAX(number) AS number FROM snippet_revisions GROUP BY snippet_id) latest
+        ON latest.snippet_id = r.snippet_id AND latest.number = r.number
+SET r.filename = s.filename;
+
+INSERT INTO snippet_revision_files (revision_id, position, filename, language, content)
+SELECT r.id, f.position, f.filename, f.language, f.content
+FROM snippet_revisions r INNER JOIN snippet_files f ON f.snippet_id = r.snippet_id
+WHERE r.number = (SELECT MAX(l.number) FROM snippet_revisions l WHERE l.snippet_id = r.snippet_id);
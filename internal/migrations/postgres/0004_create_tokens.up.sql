@@ -0,0 +1,10 @@
+CREATE TABLE tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    hash CHAR(64) NOT NULL,
+    created TIMESTAMP NOT NULL,
+    last_used TIMESTAMP NULL,
+    CONSTRAINT tokens_uc_hash UNIQUE (hash),
+    CONSTRAINT fk_tokens_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
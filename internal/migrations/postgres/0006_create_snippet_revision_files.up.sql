@@ -0,0 +1,21 @@
+ALTER TABLE snippet_revisions ADD COLUMN filename VARCHAR(100) NOT NULL DEFAULT '';
+
+CREATE TABLE snippet_revision_files (
+    id SERIAL PRIMARY KEY,
+    revision_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    filename VARCHAR(100) NOT NULL,
+    language VARCHAR(32) NOT NULL,
+    content TEXT NOT NULL,
+    CONSTRAINT snippet_revision_files_uc_position UNIQUE (revision_id, position),
+    CONSTRAINT fk_snippet_revision_files_revision FOREIGN KEY (revision_id) REFERENCES snippet_revisions(id) ON DELETE CASCADE
+);
+
+-- Only the current files of the snippets are known, so they are copied into their latest revisions.
+UPDATE snippet_revisions SET filename = (SELECT s.filename FROM snippets s WHERE s.id = snippet_revisions.snippet_id)
+WHERE number = (SELECT MAX(l.number) FROM snippet_revisions l WHERE l.snippet_id = snippet_revisions.snippet_id);
+
+INSERT INTO snippet_revision_files (revision_id, position, filename, language, content)
+SELECT r.id, f.position, f.filename, f.language, f.content
+FROM snippet_revisions r INNER JOIN snippet_files f ON f.snippet_id = r.snippet_id
+WHERE r.number = (SELECT MAX(l.number) FROM snippet_revisions l WHERE l.snippet_id = r.snippet_id);
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"strings"
+)
+
+// Dialect Define a Dialect type to identify the database behind the models.
+// Most of their SQL is portable, and the current time is passed in from Go
+// rather than read from the database, so the dialect is only needed for the
+// few statements which can't be written the same way everywhere. The zero
+// value is MySQL, for which the models were first written.
+type Dialect int
+
+const (
+	MySQL Dialect = iota
+	SQLite
+	Postgres
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case MySQL:
+		return "mysql"
+	case SQLite:
+		return "sqlite"
+	case Postgres:
+		return "postgres"
+	}
+	return fmt.Sprintf("Dialect(%d)", int(d))
+}
+
+// insertIgnore turns an INSERT INTO statement into one which skips the rows
+// that would break a UNIQUE constraint.
+func (d Dialect) insertIgnore(stmt string) string {
+	if d == MySQL {
+		return strings.Replace(stmt, "INSERT INTO", "INSERT IGNORE INTO", 1)
+	}
+	return stmt + " ON CONFLICT DO NOTHING"
+}
+
+// insertID runs an INSERT statement and returns the ID of the new row. The
+// Postgres driver doesn't support LastInsertId, so the ID is read from a
+// RETURNING clause instead.
+func (d Dialect) insertID(tx *sql.Tx, stmt string, args ...any) (int64, error) {
+	if d == Postgres {
+		var id int64
+		err := tx.QueryRow(stmt+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := tx.Exec(stmt, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// forUpdate returns the clause locking the rows of the snippets table, aliased
+// as s, read by a SELECT statement until the end of the transaction. SQLite
+// doesn't need one, since it only lets one connection write to the database
+// at a time.
+func (d Dialect) forUpdate() string {
+	switch d {
+	case SQLite:
+		return ""
+	case Postgres:
+		return "FOR UPDATE OF s"
+	}
+	return "FOR UPDATE"
+}
+
+// isDuplicate reports whether an error was caused by a value already used in
+// a column with a UNIQUE constraint. MySQL and Postgres name the constraint,
+// and the constraints are named like users_uc_email; SQLite names the column
+// instead.
+func (d Dialect) isDuplicate(err error, table string, column string) bool {
+	switch d {
+	case Postgres:
+		var pqError *pq.Error
+		if errors.As(err, &pqError) {
+			return pqError.Code.Name() == "unique_violation" && pqError.Constraint == table+"_uc_"+column
+		}
+	case SQLite:
+		var sqliteError sqlite3.Error
+		if errors.As(err, &sqliteError) {
+			return sqliteError.ExtendedCode == sqlite3.ErrConstraintUnique &&
+				strings.Contains(sqliteError.Error(), table+"."+column)
+		}
+	default:
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) {
+			return mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, table+"_uc_"+column)
+		}
+	}
+	return false
+}
+
+// searchDocument is the text search document of a snippet in Postgres. It
+// must match the expression of the idx_snippets_fulltext index.
+const searchDocument = `to_tsvector('english', s.title || ' ' || s.content)`
+
+// searchMatch returns the condition matching the snippets found by a search
+// query, with the values for its placeholders. MySQL uses the FULLTEXT index
+// on the title and content, and Postgres a GIN index on their text search
+// document. SQLite has no such index in our schema, so every word of the
+// query has to appear in the title or the content instead.
+func (d Dialect) searchMatch(query string) (string, []any) {
+	switch d {
+	case MySQL:
+		return "MATCH(s.title, s.content) AGAINST(? IN NATURAL LANGUAGE MODE)", []any{query}
+	case Postgres:
+		return searchDocument + " @@ plainto_tsquery('english', ?)", []any{query}
+	}
+
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return "FALSE", nil
+	}
+
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+	var conditions []string
+	var args []any
+	for _, word := range words {
+		pattern := "%" + escaper.Replace(word) + "%"
+		conditions = append(conditions, `(s.title LIKE ? ESCAPE '\' OR s.content LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// searchOrder returns the ORDER BY clause of a search, with the values for its
+// placeholders. The MATCH() expression has to be repeated there; MySQL only
+// evaluates it once. Postgres ranks the snippets with ts_rank. The snippets
+// found in SQLite aren't ranked, so they are simply ordered by recency.
+func (d Dialect) searchOrder(query string) (string, []any) {
+	switch d {
+	case MySQL:
+		return "MATCH(s.title, s.content) AGAINST(? IN NATURAL LANGUAGE MODE) DESC, s.created DESC, s.id DESC", []any{query}
+	case Postgres:
+		return "ts_rank(" + searchDocument + ", plainto_tsquery('english', ?)) DESC, s.created DESC, s.id DESC", []any{query}
+	}
+	return "s.created DESC, s.id DESC", nil
+}
@@ -0,0 +1,66 @@
+package models
+
+import "database/sql"
+
+// SnippetFile Define a SnippetFile type to hold one file of a snippet. The
+// first file (at position 0) is stored in the snippets table itself, so that
+// snippets with a single file work just as before; the other files are
+// stored in the snippet_files table, from position 1.
+type SnippetFile struct {
+	Position int
+	Filename string
+	Language string
+	Content  string
+}
+
+// insertFiles adds the extra files of a snippet, numbering them from 1 in the
+// order given. Like insertTags, it runs inside the transaction saving the
+// snippet.
+func insertFiles(tx *sql.Tx, snippetID int, files []SnippetFile) error {
+	stmt := `INSERT INTO snippet_files (snippet_id, position, filename, language, content)
+	VALUES(?, ?, ?, ?, ?)`
+
+	for i, f := range files {
+		_, err := tx.Exec(stmt, snippetID, i+1, f.Filename, f.Language, f.Content)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setFiles replaces all the extra files of a snippet.
+func setFiles(tx *sql.Tx, snippetID int, files []SnippetFile) error {
+	_, err := tx.Exec(`DELETE FROM snippet_files WHERE snippet_id = ?`, snippetID)
+	if err != nil {
+		return err
+	}
+
+	return insertFiles(tx, snippetID, files)
+}
+
+// loadFiles fills in the Files field of a snippet. Listings don't show the
+// files, so unlike loadTags it only loads them for a single snippet.
+func loadFiles(db querier, s *Snippet) error {
+	stmt := `SELECT position, filename, language, content FROM snippet_files
+	WHERE snippet_id = ? ORDER BY position`
+
+	rows, err := db.Query(stmt, s.ID)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		f := &SnippetFile{}
+		err := rows.Scan(&f.Position, &f.Filename, &f.Language, &f.Content)
+		if err != nil {
+			return err
+		}
+		s.Files = append(s.Files, f)
+	}
+
+	return rows.Err()
+}
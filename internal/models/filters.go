@@ -0,0 +1,138 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// SnippetSortSafelist holds the values accepted in SnippetFilter.Sort. A
+// leading hyphen means descending order.
+var SnippetSortSafelist = []string{"created", "-created", "title", "-title", "expires", "-expires"}
+
+// SnippetFilter Define a SnippetFilter type to hold the paging, sorting and
+// filtering options of a snippet listing. Zero values mean "no restriction".
+type SnippetFilter struct {
+	Page           int
+	PageSize       int
+	Sort           string
+	AuthorID       int
+	CreatedAfter   time.Time
+	CreatedBefore  time.Time
+	ExpiringWithin time.Duration
+	Tag            string
+}
+
+// sortColumn maps the Sort value to a column name. The value must have been
+// checked against SnippetSortSafelist already, so that nothing the user sent
+// is ever interpolated into SQL; anything else falls back to the creation
+// date.
+func (f SnippetFilter) sortColumn() string {
+	for _, safeValue := range SnippetSortSafelist {
+		if f.Sort == safeValue {
+			return strings.TrimPrefix(f.Sort, "-")
+		}
+	}
+	return "created"
+}
+
+// sortDirection returns the SQL sort direction for the Sort value.
+func (f SnippetFilter) sortDirection() string {
+	if f.Sort == "" || strings.HasPrefix(f.Sort, "-") {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// orderBy returns the ORDER BY clause for the Sort value. The id is used as a
+// secondary sort to make sure that the order is always the same. Snippets
+// which never expire are sorted as if they expired last.
+func (f SnippetFilter) orderBy() string {
+	column, direction := f.sortColumn(), f.sortDirection()
+
+	if column == "expires" {
+		return fmt.Sprintf("s.expires IS NULL %s, s.expires %s, s.id %s", direction, direction, direction)
+	}
+	return fmt.Sprintf("s.%s %s, s.id %s", column, direction, direction)
+}
+
+// where returns the conditions of the WHERE clause for the filters which have
+// been set, together with the values for their placeholders. Expired snippets
+// are always excluded, and so are unlisted and private snippets: only public
+// snippets are ever listed. Burn-after-reading snippets aren't listed either,
+// since the first visitor would destroy them, and nor are password-protected
+// ones, whose content mustn't show up in excerpts and search results.
+func (f SnippetFilter) where() ([]string, []any) {
+	conditions := []string{notExpired, listed}
+	args := []any{now()}
+
+	if f.AuthorID > 0 {
+		conditions = append(conditions, "s.user_id = ?")
+		args = append(args, f.AuthorID)
+	}
+	if !f.CreatedAfter.IsZero() {
+		conditions = append(conditions, "s.created >= ?")
+		args = append(args, f.CreatedAfter.UTC())
+	}
+	if !f.CreatedBefore.IsZero() {
+		conditions = append(conditions, "s.created < ?")
+		args = append(args, f.CreatedBefore.UTC())
+	}
+	if f.ExpiringWithin > 0 {
+		conditions = append(conditions, "s.expires <= ?")
+		args = append(args, time.Now().UTC().Add(f.ExpiringWithin))
+	}
+	if f.Tag != "" {
+		conditions = append(conditions, `EXISTS(SELECT true FROM snippet_tags st
+		INNER JOIN tags t ON t.id = st.tag_id WHERE st.snippet_id = s.id AND t.name = ?)`)
+		args = append(args, f.Tag)
+	}
+
+	return conditions, args
+}
+
+func (f SnippetFilter) limit() int {
+	return f.PageSize
+}
+
+func (f SnippetFilter) offset() int {
+	return (f.Page - 1) * f.PageSize
+}
+
+// Metadata Define a Metadata type to describe which page of a listing has
+// been returned.
+type Metadata struct {
+	CurrentPage  int `json:"current_page,omitempty"`
+	PageSize     int `json:"page_size,omitempty"`
+	FirstPage    int `json:"first_page,omitempty"`
+	LastPage     int `json:"last_page,omitempty"`
+	TotalRecords int `json:"total_records,omitempty"`
+}
+
+// calculateMetadata works out the pagination metadata from the total number of
+// records matched, the current page and the page size. An empty Metadata is
+// returned if there are no records.
+func calculateMetadata(totalRecords, page, pageSize int) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	return Metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		FirstPage:    1,
+		LastPage:     int(math.Ceil(float64(totalRecords) / float64(pageSize))),
+		TotalRecords: totalRecords,
+	}
+}
+
+// HasPrevious reports whether there is a page before the current one.
+func (m Metadata) HasPrevious() bool {
+	return m.CurrentPage > m.FirstPage
+}
+
+// HasNext reports whether there is a page after the current one.
+func (m Metadata) HasNext() bool {
+	return m.CurrentPage < m.LastPage
+}
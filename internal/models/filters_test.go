@@ -0,0 +1,67 @@
+package models
+
+import "testing"
+
+func TestCalculateMetadata(t *testing.T) {
+	tests := []struct {
+		name         string
+		totalRecords int
+		page         int
+		pageSize     int
+		want         Metadata
+	}{
+		{"No records", 0, 1, 20, Metadata{}},
+		{"Single page", 5, 1, 20, Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 5}},
+		{"Partial last page", 41, 2, 20, Metadata{CurrentPage: 2, PageSize: 20, FirstPage: 1, LastPage: 3, TotalRecords: 41}},
+		{"Exact pages", 40, 2, 20, Metadata{CurrentPage: 2, PageSize: 20, FirstPage: 1, LastPage: 2, TotalRecords: 40}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := calculateMetadata(tt.totalRecords, tt.page, tt.pageSize)
+			if got != tt.want {
+				t.Errorf("got %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnippetFilter_Sort(t *testing.T) {
+	// Values outside of the safelist must never reach the SQL statement.
+	f := SnippetFilter{Sort: "id; DROP TABLE snippets"}
+	if f.sortColumn() != "created" {
+		t.Errorf("unexpected sort column %q", f.sortColumn())
+	}
+
+	f = SnippetFilter{Sort: "-title"}
+	if f.sortColumn() != "title" || f.sortDirection() != "DESC" {
+		t.Errorf("got %s %s; want title DESC", f.sortColumn(), f.sortDirection())
+	}
+
+	f = SnippetFilter{Sort: "expires"}
+	if f.sortColumn() != "expires" || f.sortDirection() != "ASC" {
+		t.Errorf("got %s %s; want expires ASC", f.sortColumn(), f.sortDirection())
+	}
+}
+
+func TestSnippetFilter_OrderBy(t *testing.T) {
+	tests := []struct {
+		sort string
+		want string
+	}{
+		{"-created", "s.created DESC, s.id DESC"},
+		{"title", "s.title ASC, s.id ASC"},
+		// Snippets which never expire come last when expiring first.
+		{"expires", "s.expires IS NULL ASC, s.expires ASC, s.id ASC"},
+		{"-expires", "s.expires IS NULL DESC, s.expires DESC, s.id DESC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			got := SnippetFilter{Sort: tt.sort}.orderBy()
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
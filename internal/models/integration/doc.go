@@ -0,0 +1,12 @@
+// Package integration tests the database models against a real database,
+// created with the embedded migrations and loaded with the fixtures in
+// testdata. The tests are only built with the integration tag:
+//
+//	go test -tags integration ./internal/models/integration
+//
+// They use an SQLite database in a temporary directory by default. To run them
+// against MySQL instead, give the path of a MySQL 8 server binary; a server is
+// started for the tests in a temporary data directory, and stopped after them:
+//
+//	go test -tags integration ./internal/models/integration -args -mysqld=$(which mysqld)
+package integration
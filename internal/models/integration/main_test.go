@@ -0,0 +1,186 @@
+//go:build integration
+
+package integration
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/liviu-moraru/snippetbox/internal/migrations"
+	"github.com/liviu-moraru/snippetbox/internal/models"
+	_ "github.com/mattn/go-sqlite3"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var mysqldPath = flag.String("mysqld", "", "Path of a MySQL server binary; the tests use SQLite without it")
+
+// mysqlSocket is the Unix socket of the MySQL server started by TestMain, or
+// the empty string when the tests use SQLite.
+var mysqlSocket string
+
+// databases counts the MySQL databases created for the tests, to name them.
+var databases int64
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	if *mysqldPath == "" {
+		os.Exit(m.Run())
+	}
+
+	dir, err := os.MkdirTemp("", "snippetbox-mysql")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	stop, err := startMySQL(*mysqldPath, dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		log.Fatal(err)
+	}
+
+	code := m.Run()
+
+	stop()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// startMySQL initializes a data directory in dir, and starts a MySQL server
+// on it which only listens on a Unix socket. It returns a function which
+// stops the server.
+func startMySQL(mysqld string, dir string) (func(), error) {
+	datadir := filepath.Join(dir, "data")
+	mysqlSocket = filepath.Join(dir, "mysqld.sock")
+
+	args := []string{"--no-defaults"}
+	// mysqld refuses to run as root unless it is asked to.
+	if os.Geteuid() == 0 {
+		args = append(args, "--user=root")
+	}
+
+	// The root account of the new data directory has no password.
+	init := exec.Command(mysqld, append(args, "--initialize-insecure", "--datadir="+datadir)...)
+	out, err := init.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("initialize mysql data directory: %w: %s", err, out)
+	}
+
+	server := exec.Command(mysqld, append(args,
+		"--datadir="+datadir,
+		"--socket="+mysqlSocket,
+		"--pid-file="+filepath.Join(dir, "mysqld.pid"),
+		"--log-error="+filepath.Join(dir, "mysqld.log"),
+		"--skip-networking",
+		"--mysqlx=OFF",
+	)...)
+	err = server.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	stop := func() {
+		server.Process.Signal(os.Interrupt)
+		server.Wait()
+	}
+
+	// Wait for the server to accept connections.
+	db, err := sql.Open("mysql", "root@unix("+mysqlSocket+")/")
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	defer db.Close()
+
+	for deadline := time.Now().Add(time.Minute); ; {
+		err = db.Ping()
+		if err == nil {
+			return stop, nil
+		}
+		if time.Now().After(deadline) {
+			stop()
+			return nil, fmt.Errorf("mysql server didn't start, see %s: %w", filepath.Join(dir, "mysqld.log"), err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// newTestDB returns a new database, migrated to the latest version and
+// loaded with the fixtures, and the dialect of the models using it.
+func newTestDB(t *testing.T) (*sql.DB, models.Dialect) {
+	t.Helper()
+
+	var db *sql.DB
+	var dialect models.Dialect
+	var err error
+
+	if mysqlSocket == "" {
+		dialect = models.SQLite
+		db, err = sql.Open("sqlite3", filepath.Join(t.TempDir(), "snippetbox.db")+"?_foreign_keys=on")
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.SetMaxOpenConns(1)
+	} else {
+		dialect = models.MySQL
+		db = newMySQLDB(t)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.New(db, dialect.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = migrator.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixtures, err := os.ReadFile("./testdata/fixtures.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range migrations.Statements(string(fixtures)) {
+		_, err = db.Exec(stmt)
+		if err != nil {
+			t.Fatalf("load fixtures: %v\n%s", err, stmt)
+		}
+	}
+
+	return db, dialect
+}
+
+// newMySQLDB creates a database of its own for a test on the MySQL server,
+// which is dropped after the test.
+func newMySQLDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	name := fmt.Sprintf("test_%d", atomic.AddInt64(&databases, 1))
+
+	root, err := sql.Open("mysql", "root@unix("+mysqlSocket+")/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		root.Exec("DROP DATABASE " + name)
+		root.Close()
+	})
+
+	_, err = root.Exec("CREATE DATABASE " + name + " CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("mysql", "root@unix("+mysqlSocket+")/"+name+"?parseTime=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
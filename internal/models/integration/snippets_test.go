@@ -0,0 +1,313 @@
+//go:build integration
+
+package integration
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/liviu-moraru/snippetbox/internal/models"
+	"testing"
+	"time"
+)
+
+func TestSnippetModelGet(t *testing.T) {
+	db, dialect := newTestDB(t)
+	m := &models.SnippetModel{DB: db, Dialect: dialect}
+
+	tests := []struct {
+		name        string
+		id          int
+		wantTitle   string
+		wantExpires bool
+		wantErr     error
+	}{
+		{
+			name:        "Expires later",
+			id:          1,
+			wantTitle:   "An old silent pond",
+			wantExpires: true,
+		},
+		{
+			name:    "Expired",
+			id:      2,
+			wantErr: models.ErrNoRecord,
+		},
+		{
+			name:      "Never expires",
+			id:        3,
+			wantTitle: "First autumn morning",
+		},
+		{
+			name:        "Private",
+			id:          4,
+			wantTitle:   "A private note",
+			wantExpires: true,
+		},
+		{
+			name:        "Unlisted",
+			id:          5,
+			wantTitle:   "An unlisted note",
+			wantExpires: true,
+		},
+		{
+			name:    "Non-existent ID",
+			id:      99,
+			wantErr: models.ErrNoRecord,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := m.Get(tt.id)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("got error %v; want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if s.Title.String != tt.wantTitle {
+				t.Errorf("got title %q; want %q", s.Title.String, tt.wantTitle)
+			}
+			if s.Expires.Valid != tt.wantExpires {
+				t.Errorf("got expires %v; want set to be %t", s.Expires, tt.wantExpires)
+			}
+			if s.Author != "Alice Jones" {
+				t.Errorf("got author %q; want %q", s.Author, "Alice Jones")
+			}
+		})
+	}
+}
+
+func TestSnippetModelLatest(t *testing.T) {
+	db, dialect := newTestDB(t)
+	m := &models.SnippetModel{DB: db, Dialect: dialect}
+
+	// Neither the expired, the private nor the unlisted snippet is listed,
+	// and the newest snippet comes first.
+	snippets, err := m.Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := snippetIDs(snippets)
+	if len(got) != 2 || got[0] != 3 || got[1] != 1 {
+		t.Errorf("got snippets %v; want [3 1]", got)
+	}
+}
+
+func TestSnippetModelVisibility(t *testing.T) {
+	db, dialect := newTestDB(t)
+	m := &models.SnippetModel{DB: db, Dialect: dialect}
+
+	const owner, stranger = 1, 2
+
+	tests := []struct {
+		name        string
+		id          int
+		slug        string
+		wantByID    bool
+		wantBySlug  bool
+		wantByOwner bool
+	}{
+		{"Public", 1, "0000000001", true, true, true},
+		{"Private", 4, "0000000004", false, false, true},
+		{"Unlisted", 5, "0000000005", false, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, viewer := range []int{0, stranger} {
+				_, err := m.GetVisible(tt.id, viewer)
+				if found := err == nil; found != tt.wantByID {
+					t.Errorf("GetVisible by viewer %d: got found %t (error %v); want %t", viewer, found, err, tt.wantByID)
+				}
+
+				_, err = m.GetBySlug(tt.slug, viewer)
+				if found := err == nil; found != tt.wantBySlug {
+					t.Errorf("GetBySlug by viewer %d: got found %t (error %v); want %t", viewer, found, err, tt.wantBySlug)
+				}
+			}
+
+			_, err := m.GetVisible(tt.id, owner)
+			if found := err == nil; found != tt.wantByOwner {
+				t.Errorf("GetVisible by the owner: got found %t (error %v); want %t", found, err, tt.wantByOwner)
+			}
+
+			_, err = m.GetBySlug(tt.slug, owner)
+			if found := err == nil; found != tt.wantByOwner {
+				t.Errorf("GetBySlug by the owner: got found %t (error %v); want %t", found, err, tt.wantByOwner)
+			}
+		})
+	}
+
+	// The listings never include private or unlisted snippets, not even
+	// for their owner.
+	filter := models.SnippetFilter{Page: 1, PageSize: 20, Sort: "-created"}
+
+	listed, _, err := m.List(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := snippetIDs(listed); len(got) != 2 || got[0] != 3 || got[1] != 1 {
+		t.Errorf("List: got snippets %v; want [3 1]", got)
+	}
+
+	filter.AuthorID = owner
+	listed, _, err = m.List(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := snippetIDs(listed); len(got) != 2 || got[0] != 3 || got[1] != 1 {
+		t.Errorf("List by author: got snippets %v; want [3 1]", got)
+	}
+
+	found, _, err := m.Search("silent", models.SnippetFilter{Page: 1, PageSize: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := snippetIDs(found); len(got) != 1 || got[0] != 1 {
+		t.Errorf("Search: got snippets %v; want [1]", got)
+	}
+}
+
+// snippetIDs returns the IDs of a list of snippets, in order.
+func snippetIDs(snippets []*models.Snippet) []int {
+	var ids []int
+	for _, s := range snippets {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
+
+func TestSnippetModelInsert(t *testing.T) {
+	db, dialect := newTestDB(t)
+	m := &models.SnippetModel{DB: db, Dialect: dialect}
+
+	now := time.Now().UTC()
+
+	tests := []struct {
+		name       string
+		expires    sql.NullTime
+		wantFound  bool
+		wantLatest bool
+	}{
+		{
+			name:       "Expires later",
+			expires:    sql.NullTime{Time: now.Add(24 * time.Hour), Valid: true},
+			wantFound:  true,
+			wantLatest: true,
+		},
+		{
+			name:       "Never expires",
+			wantFound:  true,
+			wantLatest: true,
+		},
+		{
+			name:    "Already expired",
+			expires: sql.NullTime{Time: now.Add(-time.Minute), Valid: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := models.SnippetInput{
+				Title:      tt.name,
+				Content:    "An old silent pond...",
+				Language:   "plaintext",
+				Format:     models.FormatPlain,
+				Visibility: models.VisibilityPublic,
+				Expires:    tt.expires,
+			}
+
+			id, err := m.Insert(1, input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := m.Get(id)
+			if !tt.wantFound {
+				if !errors.Is(err, models.ErrNoRecord) {
+					t.Errorf("got error %v; want ErrNoRecord", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else {
+				if s.Title.String != input.Title || s.Content != input.Content {
+					t.Errorf("unexpected snippet %+v", s)
+				}
+				if s.Slug == "" {
+					t.Error("got an empty slug")
+				}
+				// DATETIME columns have no fractional seconds, and MySQL
+				// rounds them rather than truncating.
+				diff := s.Expires.Time.Sub(tt.expires.Time)
+				if s.Expires.Valid != tt.expires.Valid || diff < -time.Second || diff > time.Second {
+					t.Errorf("got expires %v; want %v", s.Expires, tt.expires)
+				}
+			}
+
+			latest, err := m.Latest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			listed := len(latest) > 0 && latest[0].ID == id
+			if listed != tt.wantLatest {
+				t.Errorf("got latest snippet %t; want %t", listed, tt.wantLatest)
+			}
+		})
+	}
+}
+
+func TestSnippetRevisionModelDeletedUser(t *testing.T) {
+	db, dialect := newTestDB(t)
+	m := &models.SnippetModel{DB: db, Dialect: dialect}
+	revisions := &models.SnippetRevisionModel{DB: db}
+
+	input := models.SnippetInput{
+		Title:      "An old silent pond",
+		Content:    "An old silent pond...",
+		Language:   "plaintext",
+		Format:     models.FormatPlain,
+		Visibility: models.VisibilityPublic,
+	}
+
+	id, err := m.Insert(1, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input.Content = "A frog jumps into the pond,"
+	err = m.Update(id, 2, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The revisions Bob saved of Alice's snippet are kept when he is deleted.
+	_, err = db.Exec("DELETE FROM users WHERE id = 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := revisions.List(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("got %d revisions; want 2", len(list))
+	}
+	if list[0].UserID != 0 || list[0].Author != "" {
+		t.Errorf("got revision by %d %q; want one by a deleted user", list[0].UserID, list[0].Author)
+	}
+	if list[1].UserID != 1 || list[1].Author != "Alice Jones" {
+		t.Errorf("got revision by %d %q; want one by Alice", list[1].UserID, list[1].Author)
+	}
+
+	_, err = revisions.Get(id, 2)
+	if err != nil {
+		t.Error(err)
+	}
+}
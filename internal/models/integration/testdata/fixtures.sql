@@ -0,0 +1,71 @@
+-- The fixtures are loaded into a freshly migrated database before each test.
+-- The statements are run one at a time, so each must end with a semicolon at
+-- the end of a line. They must work with both MySQL and SQLite.
+
+-- The password of Alice is "pa$$word". Bob's account has been disabled.
+INSERT INTO users (name, email, hashed_password, created, active) VALUES (
+    'Alice Jones',
+    'alice@example.com',
+    '$2a$12$lI4hkBLEvPPrjK4F91EfDO6TnMUWd3iFSpReAmiJj5xRy4PLe77XG',
+    '2022-01-01 09:18:24',
+    TRUE
+);
+
+INSERT INTO users (name, email, hashed_password, created, active) VALUES (
+    'Bob Smith',
+    'bob@example.com',
+    '$2a$12$lI4hkBLEvPPrjK4F91EfDO6TnMUWd3iFSpReAmiJj5xRy4PLe77XG',
+    '2022-01-01 09:18:24',
+    FALSE
+);
+
+INSERT INTO snippets (user_id, slug, title, content, created, expires) VALUES (
+    1,
+    '0000000001',
+    'An old silent pond',
+    'An old silent pond...',
+    '2022-01-01 10:00:00',
+    '2099-01-01 10:00:00'
+);
+
+-- Expired long ago.
+INSERT INTO snippets (user_id, slug, title, content, created, expires) VALUES (
+    1,
+    '0000000002',
+    'Over the wintry forest',
+    'Over the wintry forest, winds howl in rage',
+    '2022-01-02 10:00:00',
+    '2022-01-09 10:00:00'
+);
+
+-- Never expires.
+INSERT INTO snippets (user_id, slug, title, content, created, expires) VALUES (
+    1,
+    '0000000003',
+    'First autumn morning',
+    'First autumn morning, the mirror I stare into',
+    '2022-01-03 10:00:00',
+    NULL
+);
+
+-- Neither private nor unlisted snippets are ever listed, but both share a
+-- word with the first snippet so that searches could find them.
+INSERT INTO snippets (user_id, slug, title, content, visibility, created, expires) VALUES (
+    1,
+    '0000000004',
+    'A private note',
+    'A silent note, not for your eyes',
+    'private',
+    '2022-01-04 10:00:00',
+    '2099-01-01 10:00:00'
+);
+
+INSERT INTO snippets (user_id, slug, title, content, visibility, created, expires) VALUES (
+    1,
+    '0000000005',
+    'An unlisted note',
+    'A silent note, for those who have the link',
+    'unlisted',
+    '2022-01-05 10:00:00',
+    '2099-01-01 10:00:00'
+);
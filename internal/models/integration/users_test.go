@@ -0,0 +1,100 @@
+//go:build integration
+
+package integration
+
+import (
+	"errors"
+	"github.com/liviu-moraru/snippetbox/internal/models"
+	"testing"
+)
+
+func TestUserModelInsert(t *testing.T) {
+	db, dialect := newTestDB(t)
+	m := &models.UserModel{DB: db, Dialect: dialect}
+
+	tests := []struct {
+		name    string
+		email   string
+		wantErr error
+	}{
+		{
+			name:  "New email",
+			email: "carol@example.com",
+		},
+		{
+			name:    "Duplicate email",
+			email:   "alice@example.com",
+			wantErr: models.ErrDuplicateEmail,
+		},
+		{
+			name:    "Email of a disabled user",
+			email:   "bob@example.com",
+			wantErr: models.ErrDuplicateEmail,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := m.Insert(tt.name, tt.email, "pa$$word")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// The new user can sign in.
+	_, err := m.Authenticate("carol@example.com", "pa$$word")
+	if err != nil {
+		t.Errorf("authenticate the new user: %v", err)
+	}
+}
+
+func TestUserModelAuthenticate(t *testing.T) {
+	db, dialect := newTestDB(t)
+	m := &models.UserModel{DB: db, Dialect: dialect}
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		wantID   int
+		wantErr  error
+	}{
+		{
+			name:     "Valid credentials",
+			email:    "alice@example.com",
+			password: "pa$$word",
+			wantID:   1,
+		},
+		{
+			name:     "Wrong password",
+			email:    "alice@example.com",
+			password: "wrong-password",
+			wantErr:  models.ErrInvalidCredentials,
+		},
+		{
+			name:     "Unknown email",
+			email:    "carol@example.com",
+			password: "pa$$word",
+			wantErr:  models.ErrInvalidCredentials,
+		},
+		{
+			name:     "Disabled user",
+			email:    "bob@example.com",
+			password: "pa$$word",
+			wantErr:  models.ErrInvalidCredentials,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := m.Authenticate(tt.email, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v; want %v", err, tt.wantErr)
+			}
+			if err == nil && u.ID != tt.wantID {
+				t.Errorf("got user ID %d; want %d", u.ID, tt.wantID)
+			}
+		})
+	}
+}
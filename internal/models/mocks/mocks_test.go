@@ -0,0 +1,130 @@
+package mocks
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/liviu-moraru/snippetbox/internal/models"
+	"testing"
+	"time"
+)
+
+// The fakes must stay interchangeable with the database models.
+var (
+	_ models.SnippetModelInterface = (*SnippetModel)(nil)
+	_ models.UserModelInterface    = (*UserModel)(nil)
+	_ models.TokenModelInterface   = (*TokenModel)(nil)
+)
+
+func TestUserModel(t *testing.T) {
+	m := &UserModel{}
+
+	err := m.Insert("Alice Jones", "alice@example.com", "pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Insert("Alice Again", "ALICE@example.com", "pa$$word")
+	if !errors.Is(err, models.ErrDuplicateEmail) {
+		t.Errorf("got error %v; want ErrDuplicateEmail", err)
+	}
+
+	u, err := m.Authenticate("alice@example.com", "pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != 1 || u.Name != "Alice Jones" {
+		t.Errorf("unexpected user %+v", u)
+	}
+
+	_, err = m.Authenticate("alice@example.com", "wrong")
+	if !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Errorf("got error %v for a wrong password; want ErrInvalidCredentials", err)
+	}
+
+	_, err = m.Authenticate("bob@example.com", "pa$$word")
+	if !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Errorf("got error %v for an unknown email; want ErrInvalidCredentials", err)
+	}
+
+	m.Disable(1)
+
+	_, err = m.Authenticate("alice@example.com", "pa$$word")
+	if !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Errorf("got error %v for a disabled user; want ErrInvalidCredentials", err)
+	}
+
+	_, err = m.Get(1)
+	if !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("got error %v for a disabled user; want ErrNoRecord", err)
+	}
+}
+
+func TestSnippetModel(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := &SnippetModel{Users: &UserModel{}, Now: func() time.Time { return now }}
+
+	err := m.Users.Insert("Alice Jones", "alice@example.com", "pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := models.SnippetInput{
+		Title:      "An old silent pond",
+		Content:    "An old silent pond...",
+		Language:   "plaintext",
+		Format:     models.FormatPlain,
+		Visibility: models.VisibilityPublic,
+		Expires:    sql.NullTime{Time: now.Add(time.Hour), Valid: true},
+	}
+
+	id, err := m.Insert(1, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	private := input
+	private.Visibility = models.VisibilityPrivate
+	privateID, err := m.Insert(1, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := m.GetVisible(id, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Author != "Alice Jones" || s.Title.String != input.Title {
+		t.Errorf("unexpected snippet %+v", s)
+	}
+	if len(s.Slug) != 10 {
+		t.Errorf("got slug %q; want one like the database makes", s.Slug)
+	}
+
+	_, err = m.GetVisible(privateID, 2)
+	if !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("got error %v for a private snippet; want ErrNoRecord", err)
+	}
+
+	snippets, err := m.Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snippets) != 1 || snippets[0].ID != id {
+		t.Errorf("got %d latest snippets; want only the public one", len(snippets))
+	}
+
+	now = now.Add(2 * time.Hour)
+
+	_, err = m.Get(id)
+	if !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("got error %v for an expired snippet; want ErrNoRecord", err)
+	}
+
+	snippets, err = m.Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snippets) != 0 {
+		t.Errorf("got %d latest snippets after they expired", len(snippets))
+	}
+}
@@ -0,0 +1,379 @@
+// Package mocks holds in-memory implementations of the model interfaces, so
+// that the handlers can be tested without a database.
+package mocks
+
+import (
+	"database/sql"
+	"github.com/liviu-moraru/snippetbox/internal/models"
+	"golang.org/x/crypto/bcrypt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SnippetModel Define a SnippetModel type which keeps the snippets in memory.
+// It implements models.SnippetModelInterface with the same semantics as the
+// database: expired snippets can't be found, the visibility rules apply, and
+// listings only show public snippets. If Users is set, the Author of the
+// snippets is read from it. Now is the clock used for the expiry, which
+// defaults to the current time. The zero value is an empty store, ready to
+// use.
+type SnippetModel struct {
+	Users *UserModel
+	Now   func() time.Time
+
+	mu       sync.Mutex
+	snippets []*models.Snippet
+	lastID   int
+}
+
+func (m *SnippetModel) now() time.Time {
+	if m.Now != nil {
+		return m.Now().UTC()
+	}
+	return time.Now().UTC()
+}
+
+// Insert adds a snippet, with the next ID and a new random slug.
+func (m *SnippetModel) Insert(userID int, input models.SnippetInput) (int, error) {
+	return m.create(0, userID, input)
+}
+
+// Fork adds a snippet recorded as a fork of the parent snippet.
+func (m *SnippetModel) Fork(parentID int, userID int, input models.SnippetInput) (int, error) {
+	return m.create(parentID, userID, input)
+}
+
+func (m *SnippetModel) create(parentID int, userID int, input models.SnippetInput) (int, error) {
+	slug, err := models.NewSlug()
+	if err != nil {
+		return 0, err
+	}
+
+	s := &models.Snippet{
+		UserID:   userID,
+		Slug:     slug,
+		Created:  m.now(),
+		ParentID: sql.NullInt64{Int64: int64(parentID), Valid: parentID > 0},
+	}
+
+	err = setInput(s, input, true)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastID++
+	s.ID = m.lastID
+	m.snippets = append(m.snippets, s)
+
+	return s.ID, nil
+}
+
+// setInput copies the values chosen by the owner into a snippet. The
+// password is only changed when a new one is given, or when it is removed,
+// unless the snippet is new.
+func setInput(s *models.Snippet, input models.SnippetInput, created bool) error {
+	s.Title = sql.NullString{String: input.Title, Valid: true}
+	s.Content = input.Content
+	s.Language = input.Language
+	s.Format = input.Format
+	s.Visibility = input.Visibility
+	s.Expires = sql.NullTime{Time: input.Expires.Time.UTC(), Valid: input.Expires.Valid}
+	s.BurnAfterReading = input.BurnAfterReading
+	s.Encrypted = input.Encrypted
+	s.Filename = input.Filename
+
+	s.Tags = append([]string(nil), input.Tags...)
+	sort.Strings(s.Tags)
+
+	s.Files = nil
+	for i, f := range input.Files {
+		file := f
+		file.Position = i + 1
+		s.Files = append(s.Files, &file)
+	}
+
+	if created || input.Password != "" || input.RemovePassword {
+		s.HashedPassword = nil
+		if input.Password != "" {
+			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.MinCost)
+			if err != nil {
+				return err
+			}
+			s.HashedPassword = hashedPassword
+		}
+	}
+
+	return nil
+}
+
+// Get returns a snippet, whatever its visibility, or models.ErrNoRecord.
+func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
+	return m.get(func(s *models.Snippet) bool {
+		return s.ID == id
+	})
+}
+
+// GetVisible returns a snippet if it is public, or if it is owned by the
+// viewer.
+func (m *SnippetModel) GetVisible(id int, viewerID int) (*models.Snippet, error) {
+	return m.get(func(s *models.Snippet) bool {
+		return s.ID == id && (s.Visibility == models.VisibilityPublic || s.UserID == viewerID)
+	})
+}
+
+// GetBySlug returns a snippet by its slug, unless it is private and isn't
+// owned by the viewer.
+func (m *SnippetModel) GetBySlug(slug string, viewerID int) (*models.Snippet, error) {
+	return m.get(func(s *models.Snippet) bool {
+		return s.Slug == slug && (s.Visibility != models.VisibilityPrivate || s.UserID == viewerID)
+	})
+}
+
+// get returns a copy of the first non-expired snippet matching a condition.
+func (m *SnippetModel) get(match func(*models.Snippet) bool) (*models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	for _, s := range m.snippets {
+		if !m.expired(s, now) && match(s) {
+			return m.copy(s), nil
+		}
+	}
+
+	return nil, models.ErrNoRecord
+}
+
+// Latest returns the 10 most recently created snippets.
+func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
+	snippets, _, err := m.List(models.SnippetFilter{Page: 1, PageSize: 10, Sort: "-created"})
+	return snippets, err
+}
+
+// List returns one page of the public snippets matching the filter.
+func (m *SnippetModel) List(filter models.SnippetFilter) ([]*models.Snippet, models.Metadata, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	matches := m.filter(filter)
+
+	column := strings.TrimPrefix(filter.Sort, "-")
+	descending := filter.Sort == "" || strings.HasPrefix(filter.Sort, "-")
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if descending {
+			a, b = b, a
+		}
+
+		switch column {
+		case "title":
+			if a.Title.String != b.Title.String {
+				return a.Title.String < b.Title.String
+			}
+		case "expires":
+			// Snippets which never expire are sorted as if they expired last.
+			if a.Expires.Valid != b.Expires.Valid {
+				return a.Expires.Valid
+			}
+			if !a.Expires.Time.Equal(b.Expires.Time) {
+				return a.Expires.Time.Before(b.Expires.Time)
+			}
+		default:
+			if !a.Created.Equal(b.Created) {
+				return a.Created.Before(b.Created)
+			}
+		}
+		return a.ID < b.ID
+	})
+
+	return m.page(matches, filter)
+}
+
+// Search returns one page of the public, unencrypted snippets whose title or
+// content contains every word of the query, newest first.
+func (m *SnippetModel) Search(query string, filter models.SnippetFilter) ([]*models.Snippet, models.Metadata, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	words := strings.Fields(strings.ToLower(query))
+
+	var matches []*models.Snippet
+	for _, s := range m.filter(filter) {
+		if s.Encrypted || len(words) == 0 {
+			continue
+		}
+
+		text := strings.ToLower(s.Title.String + " " + s.Content)
+		found := true
+		for _, word := range words {
+			if !strings.Contains(text, word) {
+				found = false
+			}
+		}
+		if found {
+			matches = append(matches, s)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Created.After(matches[j].Created) ||
+			matches[i].Created.Equal(matches[j].Created) && matches[i].ID > matches[j].ID
+	})
+
+	return m.page(matches, filter)
+}
+
+// filter returns the listed snippets matching the filter, in the order they
+// were inserted. The mutex must be held.
+func (m *SnippetModel) filter(filter models.SnippetFilter) []*models.Snippet {
+	now := m.now()
+
+	var matches []*models.Snippet
+	for _, s := range m.snippets {
+		switch {
+		case m.expired(s, now), s.Visibility != models.VisibilityPublic, s.BurnAfterReading, s.HashedPassword != nil:
+			continue
+		case filter.AuthorID > 0 && s.UserID != filter.AuthorID:
+			continue
+		case !filter.CreatedAfter.IsZero() && s.Created.Before(filter.CreatedAfter):
+			continue
+		case !filter.CreatedBefore.IsZero() && !s.Created.Before(filter.CreatedBefore):
+			continue
+		case filter.ExpiringWithin > 0 && (!s.Expires.Valid || s.Expires.Time.After(now.Add(filter.ExpiringWithin))):
+			continue
+		case filter.Tag != "" && !hasTag(s, filter.Tag):
+			continue
+		}
+		matches = append(matches, s)
+	}
+	return matches
+}
+
+// page returns copies of the snippets on the page asked for by the filter,
+// with the pagination metadata. The mutex must be held.
+func (m *SnippetModel) page(matches []*models.Snippet, filter models.SnippetFilter) ([]*models.Snippet, models.Metadata, error) {
+	if len(matches) == 0 {
+		return nil, models.Metadata{}, nil
+	}
+
+	metadata := models.Metadata{
+		CurrentPage:  filter.Page,
+		PageSize:     filter.PageSize,
+		FirstPage:    1,
+		LastPage:     int(math.Ceil(float64(len(matches)) / float64(filter.PageSize))),
+		TotalRecords: len(matches),
+	}
+
+	var snippets []*models.Snippet
+	for i := (filter.Page - 1) * filter.PageSize; i < len(matches) && len(snippets) < filter.PageSize; i++ {
+		snippets = append(snippets, m.copy(matches[i]))
+	}
+
+	return snippets, metadata, nil
+}
+
+// Update replaces the values chosen by the owner of a snippet. The fake keeps
+// no history, so the ID of the editing user isn't used.
+func (m *SnippetModel) Update(id int, userID int, input models.SnippetInput) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.snippets {
+		if s.ID == id {
+			return setInput(s, input, false)
+		}
+	}
+
+	return nil
+}
+
+// Burn deletes a non-expired burn-after-reading snippet and returns it.
+func (m *SnippetModel) Burn(id int) (*models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	for i, s := range m.snippets {
+		if s.ID == id && s.BurnAfterReading && !m.expired(s, now) {
+			m.snippets = append(m.snippets[:i], m.snippets[i+1:]...)
+			return m.copy(s), nil
+		}
+	}
+
+	return nil, models.ErrNoRecord
+}
+
+// Delete removes a snippet, or returns models.ErrNoRecord. The forks of the
+// snippet are kept, and stop pointing at it.
+func (m *SnippetModel) Delete(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, s := range m.snippets {
+		if s.ID == id {
+			m.snippets = append(m.snippets[:i], m.snippets[i+1:]...)
+			for _, fork := range m.snippets {
+				if fork.ParentID.Valid && fork.ParentID.Int64 == int64(id) {
+					fork.ParentID = sql.NullInt64{}
+				}
+			}
+			return nil
+		}
+	}
+
+	return models.ErrNoRecord
+}
+
+func (m *SnippetModel) expired(s *models.Snippet, now time.Time) bool {
+	return s.Expires.Valid && !s.Expires.Time.After(now)
+}
+
+// copy returns a copy of a snippet, with its author, parent slug and number of
+// forks, so that the callers can't change the stored snippets. The mutex must
+// be held.
+func (m *SnippetModel) copy(s *models.Snippet) *models.Snippet {
+	c := *s
+	c.Tags = append([]string(nil), s.Tags...)
+
+	c.Files = nil
+	for _, f := range s.Files {
+		file := *f
+		c.Files = append(c.Files, &file)
+	}
+
+	if m.Users != nil {
+		c.Author = m.Users.name(s.UserID)
+	}
+
+	c.ParentSlug = sql.NullString{}
+	for _, parent := range m.snippets {
+		if s.ParentID.Valid && parent.ID == int(s.ParentID.Int64) && parent.Visibility == models.VisibilityPublic {
+			c.ParentSlug = sql.NullString{String: parent.Slug, Valid: true}
+		}
+	}
+
+	c.Forks = 0
+	for _, fork := range m.snippets {
+		if fork.ParentID.Valid && fork.ParentID.Int64 == int64(s.ID) {
+			c.Forks++
+		}
+	}
+
+	return &c
+}
+
+func hasTag(s *models.Snippet, name string) bool {
+	for _, tag := range s.Tags {
+		if tag == name {
+			return true
+		}
+	}
+	return false
+}
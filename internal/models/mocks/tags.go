@@ -0,0 +1,45 @@
+package mocks
+
+import (
+	"github.com/liviu-moraru/snippetbox/internal/models"
+	"sort"
+)
+
+// TagModel Define a TagModel type which reads the tags of the snippets held by
+// a SnippetModel, which must be set. It implements models.TagModelInterface
+// with the same semantics as the database: only the tags of the snippets
+// which appear in the listings are counted.
+type TagModel struct {
+	Snippets *SnippetModel
+}
+
+// List returns the tags used by at least one listed snippet, ordered by name.
+func (m *TagModel) List() ([]*models.Tag, error) {
+	m.Snippets.mu.Lock()
+	defer m.Snippets.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, s := range m.Snippets.filter(models.SnippetFilter{}) {
+		for _, tag := range s.Tags {
+			counts[tag]++
+		}
+	}
+
+	tags := make([]*models.Tag, 0, len(counts))
+	for name, n := range counts {
+		tags = append(tags, &models.Tag{Name: name, Snippets: n})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+
+	return tags, nil
+}
+
+// Exists reports whether a tag is used by at least one listed snippet.
+func (m *TagModel) Exists(name string) (bool, error) {
+	m.Snippets.mu.Lock()
+	defer m.Snippets.mu.Unlock()
+
+	return len(m.Snippets.filter(models.SnippetFilter{Tag: name})) > 0, nil
+}
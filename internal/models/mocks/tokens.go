@@ -0,0 +1,102 @@
+package mocks
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"github.com/liviu-moraru/snippetbox/internal/models"
+	"sync"
+	"time"
+)
+
+// TokenModel Define a TokenModel type which keeps the API tokens in memory. It
+// implements models.TokenModelInterface with the same semantics as the
+// database: users can only revoke their own tokens, and the tokens of
+// disabled users don't authenticate anyone. The owners of the tokens are read
+// from Users, which must be set.
+type TokenModel struct {
+	Users *UserModel
+
+	mu     sync.Mutex
+	tokens []*token
+	lastID int
+}
+
+// token is a stored token, with its plain-text value. The fake has nothing to
+// protect, so it doesn't hash it.
+type token struct {
+	models.Token
+	plaintext string
+}
+
+// Insert creates a new named token for a user and returns its plain-text
+// value.
+func (m *TokenModel) Insert(userID int, name string) (string, error) {
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	plaintext := base64.RawURLEncoding.EncodeToString(randomBytes)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastID++
+	m.tokens = append(m.tokens, &token{
+		Token:     models.Token{ID: m.lastID, UserID: userID, Name: name, Created: time.Now().UTC()},
+		plaintext: plaintext,
+	})
+
+	return plaintext, nil
+}
+
+// List returns copies of the tokens belonging to a user, newest first.
+func (m *TokenModel) List(userID int) ([]*models.Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tokens []*models.Token
+	for i := len(m.tokens) - 1; i >= 0; i-- {
+		if m.tokens[i].UserID == userID {
+			t := m.tokens[i].Token
+			tokens = append(tokens, &t)
+		}
+	}
+	return tokens, nil
+}
+
+// Delete revokes a token of a user, or returns models.ErrNoRecord.
+func (m *TokenModel) Delete(id int, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, t := range m.tokens {
+		if t.ID == id && t.UserID == userID {
+			m.tokens = append(m.tokens[:i], m.tokens[i+1:]...)
+			return nil
+		}
+	}
+	return models.ErrNoRecord
+}
+
+// GetUser returns the active user that owns a plain-text token, and records
+// when the token was last used.
+func (m *TokenModel) GetUser(plaintext string) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.tokens {
+		if t.plaintext != plaintext {
+			continue
+		}
+
+		u, err := m.Users.Get(t.UserID)
+		if err != nil {
+			return nil, err
+		}
+		t.LastUsed = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+		return u, nil
+	}
+	return nil, models.ErrNoRecord
+}
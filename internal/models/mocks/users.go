@@ -0,0 +1,123 @@
+package mocks
+
+import (
+	"errors"
+	"github.com/liviu-moraru/snippetbox/internal/models"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UserModel Define a UserModel type which keeps the users in memory. It
+// implements models.UserModelInterface with the same semantics as the
+// database: emails are unique regardless of case, wrong credentials give
+// models.ErrInvalidCredentials, and disabled users are treated as if they
+// didn't exist. The zero value is an empty store, ready to use.
+type UserModel struct {
+	mu    sync.Mutex
+	users []*models.User
+}
+
+// Insert adds a user, whose ID is the number of users inserted so far.
+func (m *UserModel) Insert(name string, email string, password string) error {
+	// The minimum cost keeps the tests fast; the passwords are never stored.
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if strings.EqualFold(u.Email, email) {
+			return models.ErrDuplicateEmail
+		}
+	}
+
+	m.users = append(m.users, &models.User{
+		ID:             len(m.users) + 1,
+		Name:           name,
+		Email:          email,
+		HashedPassword: hashedPassword,
+		Created:        time.Now().UTC(),
+		Active:         true,
+	})
+
+	return nil
+}
+
+// Authenticate returns the active user with the email and password given.
+func (m *UserModel) Authenticate(email string, password string) (models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if !u.Active || !strings.EqualFold(u.Email, email) {
+			continue
+		}
+
+		err := bcrypt.CompareHashAndPassword(u.HashedPassword, []byte(password))
+		if err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return models.User{}, models.ErrInvalidCredentials
+			}
+			return models.User{}, err
+		}
+		return models.User{ID: u.ID, Name: u.Name, HashedPassword: u.HashedPassword}, nil
+	}
+
+	return models.User{}, models.ErrInvalidCredentials
+}
+
+// Get returns the active user with a specific ID, or models.ErrNoRecord.
+func (m *UserModel) Get(id int) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.find(id)
+	if u == nil {
+		return nil, models.ErrNoRecord
+	}
+
+	return &models.User{ID: u.ID, Name: u.Name, Email: u.Email, Created: u.Created, Active: u.Active}, nil
+}
+
+// Disable marks a user as inactive, as an administrator would in the
+// database.
+func (m *UserModel) Disable(id int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.ID == id {
+			u.Active = false
+		}
+	}
+}
+
+// name returns the name of a user, active or not, for the Author of the
+// snippets.
+func (m *UserModel) name(id int) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.ID == id {
+			return u.Name
+		}
+	}
+	return ""
+}
+
+// find returns the active user with a specific ID, or nil. The mutex must be
+// held.
+func (m *UserModel) find(id int) *models.User {
+	for _, u := range m.users {
+		if u.ID == id && u.Active {
+			return u
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"context"
+	"database/sql/driver"
+	"github.com/lib/pq"
+	"strconv"
+	"strings"
+)
+
+// NewPostgresConnector returns a connector for the Postgres database named by
+// a lib/pq data source name, to be opened with sql.OpenDB. The models are
+// written with ? placeholders, which Postgres doesn't understand, so the
+// connections it makes rewrite them to $1, $2, ... in every statement.
+func NewPostgresConnector(dsn string) (driver.Connector, error) {
+	c, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &postgresConnector{Connector: c}, nil
+}
+
+type postgresConnector struct {
+	*pq.Connector
+}
+
+func (c *postgresConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &postgresConn{pqConn: conn.(pqConn)}, nil
+}
+
+// pqConn lists the interfaces implemented by the lib/pq connections, so that
+// postgresConn keeps all of them.
+type pqConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.QueryerContext
+	driver.ExecerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+// postgresConn wraps a lib/pq connection, rebinding the placeholders of the
+// statements on their way through.
+type postgresConn struct {
+	pqConn
+}
+
+func (c *postgresConn) Prepare(query string) (driver.Stmt, error) {
+	return c.pqConn.Prepare(rebind(query))
+}
+
+func (c *postgresConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.pqConn.PrepareContext(ctx, rebind(query))
+}
+
+func (c *postgresConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.pqConn.QueryContext(ctx, rebind(query), args)
+}
+
+func (c *postgresConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.pqConn.ExecContext(ctx, rebind(query), args)
+}
+
+// rebind replaces the ? placeholders of a statement with the numbered $n
+// placeholders used by Postgres. Question marks inside quoted strings are
+// left alone.
+func rebind(query string) string {
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+
+	n := 0
+	quoted := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case c == '?' && !quoted:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"testing"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "No placeholders",
+			query: "SELECT id FROM users",
+			want:  "SELECT id FROM users",
+		},
+		{
+			name:  "Placeholders",
+			query: "SELECT id FROM snippets WHERE user_id = ? AND slug = ? LIMIT ? OFFSET ?",
+			want:  "SELECT id FROM snippets WHERE user_id = $1 AND slug = $2 LIMIT $3 OFFSET $4",
+		},
+		{
+			name:  "Quoted question mark",
+			query: "SELECT id FROM snippets WHERE title = 'Why?' AND id = ?",
+			want:  "SELECT id FROM snippets WHERE title = 'Why?' AND id = $1",
+		},
+		{
+			name:  "Escaped quote",
+			query: "SELECT id FROM snippets WHERE title = 'It''s ?' AND id = ?",
+			want:  "SELECT id FROM snippets WHERE title = 'It''s ?' AND id = $1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rebind(tt.query)
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgres_IsDuplicate(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "Unique violation",
+			err:  &pq.Error{Code: "23505", Constraint: "users_uc_email"},
+			want: true,
+		},
+		{
+			name: "Wrapped unique violation",
+			err:  fmt.Errorf("insert user: %w", &pq.Error{Code: "23505", Constraint: "users_uc_email"}),
+			want: true,
+		},
+		{
+			name: "Other constraint",
+			err:  &pq.Error{Code: "23505", Constraint: "snippets_uc_slug"},
+			want: false,
+		},
+		{
+			name: "Other violation",
+			err:  &pq.Error{Code: "23503", Constraint: "users_uc_email"},
+			want: false,
+		},
+		{
+			name: "Other error",
+			err:  errors.New("users_uc_email"),
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Postgres.isDuplicate(tt.err, "users", "email")
+			if got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgres_UserModelInsertDuplicateEmail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO users").WillReturnError(&pq.Error{Code: "23505", Constraint: "users_uc_email"})
+
+	m := &UserModel{DB: db, Dialect: Postgres}
+	err = m.Insert("Alice Jones", "alice@example.com", "pa$$word")
+
+	if !errors.Is(err, ErrDuplicateEmail) {
+		t.Errorf("got error %v; want ErrDuplicateEmail", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPostgres_SnippetModelInsert(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO snippets (.+) RETURNING id").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+	mock.ExpectExec("INSERT INTO tags (.+) ON CONFLICT DO NOTHING").WithArgs("go").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO snippet_tags").WithArgs(9, "go").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO snippet_revisions").WithArgs(1, sqlmock.AnyArg(), 9).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT id FROM snippet_revisions").WithArgs(9).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec("INSERT INTO snippet_revision_files").WithArgs(1, 9).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	m := &SnippetModel{DB: db, Dialect: Postgres}
+	id, err := m.Insert(1, SnippetInput{Title: "Title", Content: "Content", Language: "go", Visibility: VisibilityPublic, Tags: []string{"go"}})
+
+	if err != nil {
+		t.Fatalf("error was not expected while inserting: %s", err)
+	}
+	if id != 9 {
+		t.Errorf("the returned value of id is not correct: %d", id)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
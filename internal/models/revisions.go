@@ -0,0 +1,214 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SnippetRevision Define a SnippetRevision type to hold one saved version of
+// a snippet. Revisions are numbered from 1 for every snippet, and are never
+// changed once written. Like a snippet, they hold the first file themselves
+// and the extra files in Files, which is only loaded by Get. The revisions
+// saved before the extra files were versioned don't have any, except for the
+// latest revision of every snippet at the time. The UserID is 0, and the
+// Author is empty, once the user who saved the revision has been deleted.
+type SnippetRevision struct {
+	ID        int
+	SnippetID int
+	Number    int
+	UserID    int
+	Author    string
+	Title     string
+	Content   string
+	Language  string
+	Encrypted bool
+	Created   time.Time
+	Filename  string
+	Files     []*SnippetFile
+}
+
+// AllFiles returns all the files of the revision in order, starting with the
+// one stored in the revision itself.
+func (r *SnippetRevision) AllFiles() []*SnippetFile {
+	files := []*SnippetFile{{Position: 0, Filename: r.Filename, Language: r.Language, Content: r.Content}}
+	return append(files, r.Files...)
+}
+
+// SnippetRevisionModel Define a SnippetRevisionModel type which wraps a
+// database connection pool.
+type SnippetRevisionModel struct {
+	DB *sql.DB
+}
+
+// insertRevision copies the current state of a snippet, including its extra
+// files, into a new revision made by the user with the given ID. It is called
+// by every statement which saves a snippet, inside the same transaction, so
+// that the history can't get out of step with the snippet.
+func insertRevision(tx *sql.Tx, snippetID int, userID int) error {
+	stmt := `INSERT INTO snippet_revisions (snippet_id, number, user_id, title, content, language, encrypted, format, filename, created)
+	SELECT s.id,
+		(SELECT COALESCE(MAX(r.number), 0) + 1 FROM snippet_revisions r WHERE r.snippet_id = s.id),
+		?, s.title, s.content, s.language, s.encrypted, s.format, s.filename, ?
+	FROM snippets s WHERE s.id = ?`
+
+	_, err := tx.Exec(stmt, userID, now(), snippetID)
+	if err != nil {
+		return err
+	}
+
+	// The new revision is the latest one of the snippet. Its ID is looked up
+	// rather than returned by the INSERT, which the drivers don't agree on.
+	var revisionID int
+	stmt = `SELECT id FROM snippet_revisions WHERE snippet_id = ? ORDER BY number DESC LIMIT 1`
+
+	err = tx.QueryRow(stmt, snippetID).Scan(&revisionID)
+	if err != nil {
+		return err
+	}
+
+	stmt = `INSERT INTO snippet_revision_files (revision_id, position, filename, language, content)
+	SELECT ?, position, filename, language, content FROM snippet_files WHERE snippet_id = ?`
+
+	_, err = tx.Exec(stmt, revisionID, snippetID)
+	return err
+}
+
+// loadRevisionFiles fills in the Files field of a revision.
+func loadRevisionFiles(db querier, r *SnippetRevision) error {
+	stmt := `SELECT position, filename, language, content FROM snippet_revision_files
+	WHERE revision_id = ? ORDER BY position`
+
+	rows, err := db.Query(stmt, r.ID)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		f := &SnippetFile{}
+		err := rows.Scan(&f.Position, &f.Filename, &f.Language, &f.Content)
+		if err != nil {
+			return err
+		}
+		r.Files = append(r.Files, f)
+	}
+
+	return rows.Err()
+}
+
+// List returns all the revisions of a snippet, newest first.
+func (m *SnippetRevisionModel) List(snippetID int) ([]*SnippetRevision, error) {
+	stmt := `SELECT r.id, r.snippet_id, r.number, COALESCE(r.user_id, 0), COALESCE(u.name, ''), r.title, r.content, r.language, r.encrypted, r.created, r.filename
+	FROM snippet_revisions r LEFT JOIN users u ON u.id = r.user_id
+	WHERE r.snippet_id = ? ORDER BY r.number DESC`
+
+	rows, err := m.DB.Query(stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var revisions []*SnippetRevision
+	for rows.Next() {
+		r := &SnippetRevision{}
+		err := rows.Scan(&r.ID, &r.SnippetID, &r.Number, &r.UserID, &r.Author, &r.Title, &r.Content, &r.Language, &r.Encrypted, &r.Created, &r.Filename)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// Get returns a specific revision of a snippet, with its extra files, or
+// ErrNoRecord if there is no such revision.
+func (m *SnippetRevisionModel) Get(snippetID int, number int) (*SnippetRevision, error) {
+	stmt := `SELECT r.id, r.snippet_id, r.number, COALESCE(r.user_id, 0), COALESCE(u.name, ''), r.title, r.content, r.language, r.encrypted, r.created, r.filename
+	FROM snippet_revisions r LEFT JOIN users u ON u.id = r.user_id
+	WHERE r.snippet_id = ? AND r.number = ?`
+
+	r := &SnippetRevision{}
+
+	err := m.DB.QueryRow(stmt, snippetID, number).Scan(&r.ID, &r.SnippetID, &r.Number, &r.UserID, &r.Author, &r.Title, &r.Content, &r.Language, &r.Encrypted, &r.Created, &r.Filename)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	err = loadRevisionFiles(m.DB, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Restore copies the title, files and format of an old revision back into the
+// snippet, together with whether its content was encrypted.
+// The visibility and expiry of the snippet are left alone. As with any other
+// save, the restored state is recorded as a new revision, made by the user
+// with the given ID, so that nothing is lost from the history.
+func (m *SnippetRevisionModel) Restore(snippetID int, number int, userID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	// The rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	// The revision is read first, rather than joined in the UPDATE statement,
+	// since every database has its own syntax for that.
+	stmt := `SELECT id, title, content, language, encrypted, format, filename FROM snippet_revisions
+	WHERE snippet_id = ? AND number = ?`
+
+	var revisionID int
+	var title, content, language, format, filename string
+	var encrypted bool
+
+	err = tx.QueryRow(stmt, snippetID, number).Scan(&revisionID, &title, &content, &language, &encrypted, &format, &filename)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	stmt = `UPDATE snippets SET title = ?, content = ?, language = ?, encrypted = ?, format = ?, filename = ?
+	WHERE id = ?`
+
+	_, err = tx.Exec(stmt, title, content, language, encrypted, format, filename, snippetID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM snippet_files WHERE snippet_id = ?`, snippetID)
+	if err != nil {
+		return err
+	}
+
+	stmt = `INSERT INTO snippet_files (snippet_id, position, filename, language, content)
+	SELECT ?, position, filename, language, content FROM snippet_revision_files WHERE revision_id = ?`
+
+	_, err = tx.Exec(stmt, snippetID, revisionID)
+	if err != nil {
+		return err
+	}
+
+	err = insertRevision(tx, snippetID, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// SessionStore Define a SessionStore type which keeps the data of the scs
+// sessions in the sessions table. It implements the scs.Store interface for
+// SQLite and Postgres, whose scs stores we don't depend on; with MySQL, the
+// scs mysqlstore package is used instead. The ON CONFLICT clause of Commit
+// works with both.
+type SessionStore struct {
+	DB          *sql.DB
+	stopCleanup chan bool
+}
+
+// NewSessionStore returns a SessionStore which deletes the expired sessions
+// from the database every cleanupInterval. An interval of 0 disables the
+// cleanup.
+func NewSessionStore(db *sql.DB, cleanupInterval time.Duration) *SessionStore {
+	s := &SessionStore{DB: db}
+	if cleanupInterval > 0 {
+		s.stopCleanup = make(chan bool)
+		go s.startCleanup(cleanupInterval)
+	}
+	return s
+}
+
+// Find returns the data of a session token, if the session exists and hasn't
+// expired.
+func (s *SessionStore) Find(token string) ([]byte, bool, error) {
+	var b []byte
+
+	err := s.DB.QueryRow(`SELECT data FROM sessions WHERE token = ? AND expiry > ?`, token, now()).Scan(&b)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	return b, true, nil
+}
+
+// Commit adds a session token and its data, or replaces the data of an
+// existing token.
+func (s *SessionStore) Commit(token string, b []byte, expiry time.Time) error {
+	stmt := `INSERT INTO sessions (token, data, expiry) VALUES (?, ?, ?)
+	ON CONFLICT (token) DO UPDATE SET data = excluded.data, expiry = excluded.expiry`
+
+	_, err := s.DB.Exec(stmt, token, b, expiry.UTC())
+	return err
+}
+
+// Delete removes a session token and its data.
+func (s *SessionStore) Delete(token string) error {
+	_, err := s.DB.Exec(`DELETE FROM sessions WHERE token = ?`, token)
+	return err
+}
+
+// StopCleanup stops the goroutine deleting the expired sessions.
+func (s *SessionStore) StopCleanup() {
+	if s.stopCleanup != nil {
+		s.stopCleanup <- true
+	}
+}
+
+func (s *SessionStore) startCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := s.deleteExpired()
+			if err != nil {
+				log.Println(err)
+			}
+		case <-s.stopCleanup:
+			return
+		}
+	}
+}
+
+func (s *SessionStore) deleteExpired() error {
+	_, err := s.DB.Exec(`DELETE FROM sessions WHERE expiry < ?`, now())
+	return err
+}
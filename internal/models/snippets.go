@@ -1,8 +1,12 @@
 package models
 
 import (
+	"crypto/rand"
 	"database/sql"
 	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
 	"time"
 )
 
@@ -10,41 +14,322 @@ import (
 // the fields of the struct correspond to the fields in our MySQL snippets
 // table?
 type Snippet struct {
-	ID      int
-	Title   sql.NullString
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID         int
+	UserID     int
+	Author     string
+	Slug       string
+	Title      sql.NullString
+	Content    string
+	Language   string
+	Visibility string
+	Created    time.Time
+	Expires    sql.NullTime
+	ParentID   sql.NullInt64
+	Forks      int
+	Tags       []string
+
+	// ParentSlug is the slug of the snippet this one was forked from, but
+	// only if that snippet is public: linking to an unlisted snippet would
+	// give its slug away to everyone who reads the fork.
+	ParentSlug sql.NullString
+
+	// BurnAfterReading snippets are deleted the first time that someone
+	// other than their owner reads them.
+	BurnAfterReading bool
+
+	// HashedPassword is the bcrypt hash of the password of the snippet, or
+	// nil if it doesn't have one.
+	HashedPassword []byte
+
+	// Encrypted snippets were encrypted in the browser. Their content is
+	// ciphertext, and the key never reaches the server.
+	Encrypted bool
+
+	// Filename is the name of the first file of the snippet, whose content
+	// and language are held in Content and Language. Files holds the other
+	// files, if any. Filename is usually empty for single-file snippets.
+	Filename string
+	Files    []*SnippetFile
+
+	// Format says how the content of the first file is shown: as code, or
+	// rendered from markdown.
+	Format string
+}
+
+// AllFiles returns all the files of the snippet in order, starting with the
+// one stored in the snippet itself.
+func (s *Snippet) AllFiles() []*SnippetFile {
+	files := []*SnippetFile{{Position: 0, Filename: s.Filename, Language: s.Language, Content: s.Content}}
+	return append(files, s.Files...)
+}
+
+// File returns the file of the snippet at a position, or nil if there is no
+// such file.
+func (s *Snippet) File(position int) *SnippetFile {
+	for _, f := range s.AllFiles() {
+		if f.Position == position {
+			return f
+		}
+	}
+	return nil
+}
+
+// Protected reports whether a password is needed to read the snippet.
+func (s *Snippet) Protected() bool {
+	return len(s.HashedPassword) > 0
 }
 
-// SnippetModel Define a SnippetModel type which wraps a sql.DB connection pool.
+// CheckPassword returns ErrInvalidCredentials unless the password matches the
+// one set on the snippet.
+func (s *Snippet) CheckPassword(password string) error {
+	err := bcrypt.CompareHashAndPassword(s.HashedPassword, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrInvalidCredentials
+		}
+		return err
+	}
+	return nil
+}
+
+// The visibility levels of a snippet. Public snippets appear in the listings,
+// unlisted snippets can only be reached through their slug and private
+// snippets can only be seen by their owner.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
+// Visibilities holds all the valid visibility levels.
+var Visibilities = []string{VisibilityPublic, VisibilityUnlisted, VisibilityPrivate}
+
+// The formats of a snippet. Plain snippets are shown as code, highlighted for
+// their language, and markdown snippets are rendered to HTML.
+const (
+	FormatPlain    = "plain"
+	FormatMarkdown = "markdown"
+)
+
+// Formats holds all the valid formats.
+var Formats = []string{FormatPlain, FormatMarkdown}
+
+// SnippetInput Define a SnippetInput type to hold the values chosen by the
+// owner of a snippet, when it is created or updated. An invalid Expires
+// means that the snippet never expires.
+type SnippetInput struct {
+	Title      string
+	Content    string
+	Language   string
+	Format     string
+	Visibility string
+	Expires    sql.NullTime
+	Tags       []string
+
+	BurnAfterReading bool
+	Encrypted        bool
+
+	// Filename names the file held in Content, and Files are the other files
+	// of the snippet. Their positions are assigned in order when saved.
+	Filename string
+	Files    []SnippetFile
+
+	// Password is the plain-text password protecting the snippet. When a
+	// snippet is updated, an empty password keeps the current one unless
+	// RemovePassword is set.
+	Password       string
+	RemovePassword bool
+}
+
+// hashPassword returns the bcrypt hash of a snippet password, ready to be
+// stored in the password_hash column. An empty password is stored as NULL.
+func hashPassword(password string) (sql.NullString, error) {
+	if password == "" {
+		return sql.NullString{}, nil
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(hashedPassword), Valid: true}, nil
+}
+
+// notExpired is the condition matching the snippets which haven't expired. A
+// NULL expiry date means that a snippet never expires. Its placeholder takes
+// the current time, from now().
+const notExpired = `(s.expires IS NULL OR s.expires > ?)`
+
+// listed is the condition matching the snippets which may appear in listings:
+// public snippets which can be read straight away, without a password and
+// without destroying them.
+const listed = `s.visibility = 'public' AND s.burn_after_reading = FALSE AND s.password_hash IS NULL`
+
+// now returns the current time, as stored in the database. All the times in
+// the database are in UTC.
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+// utc converts a time to UTC before it is stored. Not every driver does it,
+// and the DATETIME and TIMESTAMP columns don't keep the time zone.
+func utc(t sql.NullTime) sql.NullTime {
+	return sql.NullTime{Time: t.Time.UTC(), Valid: t.Valid}
+}
+
+// snippetColumns lists the columns read for every snippet. The statements
+// using it must join the users table as u, and scan the row with
+// snippetFields. The number of forks is counted with a subquery, so that the
+// statements don't need a GROUP BY, and so is the slug of a public parent.
+const snippetColumns = `s.id, s.user_id, u.name, s.slug, s.title, s.content, s.language, s.visibility, s.created, s.expires,
+	s.parent_id, (SELECT COUNT(*) FROM snippets f WHERE f.parent_id = s.id), s.burn_after_reading, s.password_hash, s.encrypted, s.filename, s.format,
+	(SELECT p.slug FROM snippets p WHERE p.id = s.parent_id AND p.visibility = 'public')`
+
+// snippetFields returns the scan destinations matching snippetColumns.
+func snippetFields(s *Snippet) []any {
+	return []any{&s.ID, &s.UserID, &s.Author, &s.Slug, &s.Title, &s.Content, &s.Language, &s.Visibility, &s.Created, &s.Expires, &s.ParentID, &s.Forks, &s.BurnAfterReading, &s.HashedPassword, &s.Encrypted, &s.Filename, &s.Format, &s.ParentSlug}
+}
+
+// slugAlphabet holds the characters used in slugs. They are all URL-safe.
+const slugAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// slugLength is the number of characters in a slug. With 62 possible
+// characters this gives over 10^14 slugs, so they can't be enumerated.
+const slugLength = 10
+
+// maxSlugAttempts is the number of times Insert tries a new slug when the one
+// it generated is already in use.
+const maxSlugAttempts = 5
+
+// NewSlug returns a random slug. Snippets are addressed by their slug, rather
+// than their sequential id, so that nobody can find them by counting.
+func NewSlug() (string, error) {
+	b := make([]byte, slugLength)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	// 256 is not a multiple of 62, so rejecting the bytes above the largest
+	// multiple would remove a tiny bias. It doesn't matter for slugs, which
+	// only need to be hard to guess, not perfectly uniform.
+	for i := range b {
+		b[i] = slugAlphabet[int(b[i])%len(slugAlphabet)]
+	}
+	return string(b), nil
+}
+
+// SnippetModelInterface Define a SnippetModelInterface type, so that the
+// handlers don't depend on a particular database, and can be tested with a
+// fake implementation.
+type SnippetModelInterface interface {
+	Insert(userID int, input SnippetInput) (int, error)
+	Fork(parentID int, userID int, input SnippetInput) (int, error)
+	Get(id int) (*Snippet, error)
+	GetVisible(id int, viewerID int) (*Snippet, error)
+	GetBySlug(slug string, viewerID int) (*Snippet, error)
+	Latest() ([]*Snippet, error)
+	List(filter SnippetFilter) ([]*Snippet, Metadata, error)
+	Search(query string, filter SnippetFilter) ([]*Snippet, Metadata, error)
+	Update(id int, userID int, input SnippetInput) error
+	Burn(id int) (*Snippet, error)
+	Delete(id int) error
+}
+
+// SnippetModel Define a SnippetModel type which wraps a sql.DB connection
+// pool, and implements SnippetModelInterface for the database of the given
+// dialect.
 type SnippetModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Dialect Dialect
+}
+
+// Insert This will insert a new snippet, owned by the user with the given ID,
+// into the database.
+func (m *SnippetModel) Insert(userID int, input SnippetInput) (int, error) {
+	return m.create(0, userID, input)
 }
 
-// Insert This will insert a new snippet into the database.
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
+// Fork inserts a new snippet, owned by the user with the given ID, which
+// records that it was copied from the snippet with the parent ID.
+func (m *SnippetModel) Fork(parentID int, userID int, input SnippetInput) (int, error) {
+	return m.create(parentID, userID, input)
+}
+
+// create inserts a snippet for Insert and Fork. A parent ID of 0 means that
+// the snippet isn't a fork.
+func (m *SnippetModel) create(parentID int, userID int, input SnippetInput) (int, error) {
+	// Each snippet gets a new random slug. In the unlikely event that it is
+	// already taken, the UNIQUE constraint on the slug column rejects the
+	// row and we simply try again with another one.
+	for attempt := 1; ; attempt++ {
+		slug, err := NewSlug()
+		if err != nil {
+			return 0, err
+		}
+
+		id, err := m.insert(slug, parentID, userID, input)
+		if err == nil {
+			return id, nil
+		}
+		if !m.Dialect.isDuplicate(err, "snippets", "slug") || attempt == maxSlugAttempts {
+			return 0, err
+		}
+	}
+}
+
+// insert adds the snippet with the given slug, together with its tags, its
+// extra files and its first revision, in a single transaction.
+func (m *SnippetModel) insert(slug string, parentID int, userID int, input SnippetInput) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	// The rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
 	// Write the SQL statement we want to execute. I've split it over two lines
 	// for readability (which is why it's surrounded with backquotes instead
 	// of normal double quotes).
-	stmt := `INSERT INTO snippets (title, content, created, expires)
-	VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+	stmt := `INSERT INTO snippets (user_id, parent_id, slug, title, content, language, visibility, created, expires,
+		burn_after_reading, password_hash, encrypted, filename, format)
+	VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	// A parent ID of 0 is stored as NULL, and so is a missing password.
+	parent := sql.NullInt64{Int64: int64(parentID), Valid: parentID > 0}
+
+	hashedPassword, err := hashPassword(input.Password)
+	if err != nil {
+		return 0, err
+	}
 
-	// Use the Exec() method on the embedded connection pool to execute the
-	// statement. The first parameter is the SQL statement, followed by the
-	// title, content and expiry values for the placeholder parameters. This
-	// method returns a sql.Result type, which contains some basic
-	// information about what happened when the statement was executed.
-	result, err := m.DB.Exec(stmt, title, content, expires)
+	// Use the insertID() method of the dialect to execute the statement on
+	// the transaction, with the values for the placeholder parameters. It
+	// returns the ID of our newly inserted record in the snippets table.
+	id, err := m.Dialect.insertID(tx, stmt, userID, parent, slug, input.Title, input.Content, input.Language, input.Visibility, now(), utc(input.Expires), input.BurnAfterReading, hashedPassword, input.Encrypted, input.Filename, input.Format)
 	if err != nil {
 		return 0, err
 	}
 
-	// Use the LastInsertId() method on the result to get the ID of our
-	// newly inserted record in the snippets table.
-	id, err := result.LastInsertId()
+	err = insertTags(tx, m.Dialect, int(id), input.Tags)
 	if err != nil {
-		return 0, nil
+		return 0, err
+	}
+
+	err = insertFiles(tx, int(id), input.Files)
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertRevision(tx, int(id), userID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
 	}
 
 	// The ID returned has the type int64, so we convert it to an int type
@@ -52,14 +337,39 @@ func (m *SnippetModel) Insert(title string, content string, expires int) (int, e
 	return int(id), nil
 }
 
-// Get This will return a specific snippet based on its id.
+// Get This will return a specific snippet based on its id, whatever its
+// visibility. It is meant for checks done on behalf of the owner; use
+// GetVisible to show a snippet to a user.
 func (m *SnippetModel) Get(id int) (*Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > UTC_TIMESTAMP() and id = ?`
+	return m.get("s.id = ?", id)
+}
+
+// GetVisible This will return a specific snippet based on its id, as long as
+// the viewer is allowed to reach it that way: public snippets can be seen by
+// anyone, unlisted and private ones only by their owner. Use 0 as the viewer
+// ID for anonymous users.
+func (m *SnippetModel) GetVisible(id int, viewerID int) (*Snippet, error) {
+	return m.get("s.id = ? AND (s.visibility = 'public' OR s.user_id = ?)", id, viewerID)
+}
+
+// GetBySlug This will return a specific snippet based on its slug. Knowing the
+// slug is enough to see public and unlisted snippets, but private snippets
+// can still only be seen by their owner.
+func (m *SnippetModel) GetBySlug(slug string, viewerID int) (*Snippet, error) {
+	return m.get("s.slug = ? AND (s.visibility <> 'private' OR s.user_id = ?)", slug, viewerID)
+}
+
+// get returns the non-expired snippet matching the condition.
+func (m *SnippetModel) get(condition string, args ...any) (*Snippet, error) {
+	// Join the users table so that the name of the author is returned
+	// together with the snippet.
+	stmt := `SELECT ` + snippetColumns + `
+	FROM snippets s INNER JOIN users u ON u.id = s.user_id
+	WHERE ` + notExpired + ` AND ` + condition
 
 	s := &Snippet{}
 
-	err := m.DB.QueryRow(stmt, id).Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	err := m.DB.QueryRow(stmt, append([]any{now()}, args...)...).Scan(snippetFields(s)...)
 	if err != nil {
 		// If the query returns no rows, then row.Scan() will return a
 		// sql.ErrNoRows error. We use the errors.Is() function check for that
@@ -72,28 +382,91 @@ func (m *SnippetModel) Get(id int) (*Snippet, error) {
 		}
 	}
 
+	err = loadTags(m.DB, s)
+	if err != nil {
+		return nil, err
+	}
+
+	err = loadFiles(m.DB, s)
+	if err != nil {
+		return nil, err
+	}
+
 	// If everything went OK then return the Snippet object.
 	return s, nil
 }
 
 // Latest This will return the 10 most recently created snippets.
 func (m *SnippetModel) Latest() ([]*Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10`
+	snippets, _, err := m.List(SnippetFilter{Page: 1, PageSize: 10, Sort: "-created"})
+	return snippets, err
+}
 
-	var snippets []*Snippet
-	rows, err := m.DB.Query(stmt)
+// List This will return one page of the non-expired snippets matching the
+// filter, together with the pagination metadata.
+func (m *SnippetModel) List(filter SnippetFilter) ([]*Snippet, Metadata, error) {
+	conditions, args := filter.where()
+
+	// The sort column and direction come from a safelist, so it is fine to
+	// interpolate the ORDER BY clause. The window function returns the total
+	// number of matching rows alongside every row.
+	stmt := fmt.Sprintf(`SELECT COUNT(*) OVER(), %s
+	FROM snippets s INNER JOIN users u ON u.id = s.user_id
+	WHERE %s
+	ORDER BY %s
+	LIMIT ? OFFSET ?`, snippetColumns, strings.Join(conditions, " AND "), filter.orderBy())
+
+	args = append(args, filter.limit(), filter.offset())
+
+	return m.queryPage(filter, stmt, args...)
+}
+
+// Search This will return one page of the non-expired snippets whose title or
+// content match the query. With MySQL the FULLTEXT index on the snippets
+// table is used, and the snippets are ranked by relevance and then by
+// recency; see Dialect.searchMatch for the other databases. The Sort
+// option of the filter is ignored; the other filters still apply. Encrypted
+// snippets are left out, since their content is just ciphertext.
+func (m *SnippetModel) Search(query string, filter SnippetFilter) ([]*Snippet, Metadata, error) {
+	conditions, args := filter.where()
+
+	match, matchArgs := m.Dialect.searchMatch(query)
+	conditions = append([]string{match, "s.encrypted = FALSE"}, conditions...)
+	args = append(matchArgs, args...)
+
+	order, orderArgs := m.Dialect.searchOrder(query)
+
+	stmt := fmt.Sprintf(`SELECT COUNT(*) OVER(), %s
+	FROM snippets s INNER JOIN users u ON u.id = s.user_id
+	WHERE %s
+	ORDER BY %s
+	LIMIT ? OFFSET ?`, snippetColumns, strings.Join(conditions, " AND "), order)
+
+	args = append(args, orderArgs...)
+	args = append(args, filter.limit(), filter.offset())
+
+	return m.queryPage(filter, stmt, args...)
+}
+
+// queryPage runs a listing statement whose first column is the total number of
+// matching rows, followed by the snippet columns, and returns the snippets
+// together with the pagination metadata.
+func (m *SnippetModel) queryPage(filter SnippetFilter, stmt string, args ...any) ([]*Snippet, Metadata, error) {
+	rows, err := m.DB.Query(stmt, args...)
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 
 	defer rows.Close()
 
+	totalRecords := 0
+	var snippets []*Snippet
+
 	for rows.Next() {
 		s := &Snippet{}
-		err := rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		err := rows.Scan(append([]any{&totalRecords}, snippetFields(s)...)...)
 		if err != nil {
-			return nil, err
+			return nil, Metadata{}, err
 		}
 		snippets = append(snippets, s)
 	}
@@ -103,8 +476,154 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 	// call this - don't assume that a successful iteration was completed
 	// over the whole resultset.
 	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	err = loadTags(m.DB, snippets...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filter.Page, filter.PageSize)
+
+	return snippets, metadata, nil
+}
+
+// Update This will change the title, content, language, visibility, expiry,
+// tags and files of an existing snippet, and records the result as a new
+// revision made by the user with the given ID.
+func (m *SnippetModel) Update(id int, userID int, input SnippetInput) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	stmt := `UPDATE snippets SET title = ?, content = ?, language = ?, visibility = ?, expires = ?,
+	burn_after_reading = ?, encrypted = ?, filename = ?, format = ?
+	WHERE id = ?`
+
+	_, err = tx.Exec(stmt, input.Title, input.Content, input.Language, input.Visibility, utc(input.Expires),
+		input.BurnAfterReading, input.Encrypted, input.Filename, input.Format, id)
+	if err != nil {
+		return err
+	}
+
+	// The password is only changed when a new one is given, or when it is
+	// removed.
+	if input.Password != "" || input.RemovePassword {
+		hashedPassword, err := hashPassword(input.Password)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`UPDATE snippets SET password_hash = ? WHERE id = ?`, hashedPassword, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = setTags(tx, m.Dialect, id, input.Tags)
+	if err != nil {
+		return err
+	}
+
+	err = setFiles(tx, id, input.Files)
+	if err != nil {
+		return err
+	}
+
+	// Every save is recorded in the history of the snippet.
+	err = insertRevision(tx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Burn This will read a burn-after-reading snippet and delete it, in a single
+// transaction. The row is locked while it is read (SQLite locks the whole
+// database instead), so that when two readers race for the same snippet only
+// one of them gets it; the other one gets ErrNoRecord, just as if the snippet
+// had already been deleted.
+func (m *SnippetModel) Burn(id int) (*Snippet, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	// The rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	stmt := `SELECT ` + snippetColumns + `
+	FROM snippets s INNER JOIN users u ON u.id = s.user_id
+	WHERE ` + notExpired + ` AND s.id = ? AND s.burn_after_reading = TRUE
+	` + m.Dialect.forUpdate()
+
+	s := &Snippet{}
+
+	err = tx.QueryRow(stmt, now(), id).Scan(snippetFields(s)...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	// The tags and files are read before the delete cascades to them.
+	err = loadTags(tx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	err = loadFiles(tx, s)
+	if err != nil {
 		return nil, err
 	}
 
-	return snippets, nil
+	result, err := tx.Exec(`DELETE FROM snippets WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without a row lock, another reader may have deleted the snippet in
+	// the meantime.
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rows == 0 {
+		return nil, ErrNoRecord
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Delete This will remove a specific snippet based on its id.
+func (m *SnippetModel) Delete(id int) error {
+	stmt := `DELETE FROM snippets WHERE id = ?`
+
+	result, err := m.DB.Exec(stmt, id)
+	if err != nil {
+		return err
+	}
+
+	// If no rows were affected then there was no snippet with this id, so we
+	// return our ErrNoRecord error.
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
 }
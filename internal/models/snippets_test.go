@@ -0,0 +1,276 @@
+package models
+
+import (
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSlug(t *testing.T) {
+	slug, err := NewSlug()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(slug) != slugLength {
+		t.Errorf("unexpected slug length %d", len(slug))
+	}
+
+	for _, c := range slug {
+		if !strings.ContainsRune(slugAlphabet, c) {
+			t.Errorf("unexpected character %q in slug %q", c, slug)
+		}
+	}
+}
+
+func TestSnippetModel_InsertRetriesDuplicateSlug(t *testing.T) {
+	// Arrange
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	duplicate := &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'abc' for key 'snippets.snippets_uc_slug'"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO snippets").WillReturnError(duplicate)
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO snippets").WillReturnResult(sqlmock.NewResult(7, 1))
+	mock.ExpectExec("INSERT INTO snippet_revisions").WithArgs(1, sqlmock.AnyArg(), 7).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("SELECT id FROM snippet_revisions").WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec("INSERT INTO snippet_revision_files").WithArgs(1, 7).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	// Act
+	m := &SnippetModel{DB: db}
+	id, err := m.Insert(1, SnippetInput{Title: "Title", Content: "Content", Language: "plaintext", Visibility: VisibilityPublic})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("error was not expected while inserting: %s", err)
+	}
+	if id != 7 {
+		t.Errorf("the returned value of id is not correct: %d", id)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSnippetModel_InsertGivesUpOnDuplicateSlug(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	duplicate := &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'abc' for key 'snippets.snippets_uc_slug'"}
+	for i := 0; i < maxSlugAttempts; i++ {
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO snippets").WillReturnError(duplicate)
+		mock.ExpectRollback()
+	}
+
+	m := &SnippetModel{DB: db}
+	_, err = m.Insert(1, SnippetInput{Title: "Title", Content: "Content", Language: "plaintext", Visibility: VisibilityPublic})
+
+	if !errors.Is(err, duplicate) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSnippetModel_UpdateWritesRevision(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE snippets").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM snippet_tags").WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("DELETE FROM snippet_files").WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO snippet_files").WithArgs(3, 1, "main_test.go", "go", "Test").WillReturnResult(sqlmock.NewResult(5, 1))
+	mock.ExpectExec("INSERT INTO snippet_files").WithArgs(3, 2, "go.mod", "plaintext", "Module").WillReturnResult(sqlmock.NewResult(6, 1))
+	mock.ExpectExec("INSERT INTO snippet_revisions").WithArgs(1, sqlmock.AnyArg(), 3).WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectQuery("SELECT id FROM snippet_revisions").WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectExec("INSERT INTO snippet_revision_files").WithArgs(2, 3).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	m := &SnippetModel{DB: db}
+	err = m.Update(3, 1, SnippetInput{Title: "Title", Content: "Content", Language: "go", Visibility: VisibilityPrivate, Filename: "main.go", Files: []SnippetFile{
+		{Filename: "main_test.go", Language: "go", Content: "Test"},
+		{Filename: "go.mod", Language: "plaintext", Content: "Module"},
+	}})
+	if err != nil {
+		t.Fatalf("error was not expected while updating: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSnippetModel_ForkRecordsParent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO snippets").
+		WithArgs(2, 5, sqlmock.AnyArg(), "Title", "Content", "go", VisibilityPublic, sqlmock.AnyArg(), nil, false, nil, false, "", FormatPlain).
+		WillReturnResult(sqlmock.NewResult(8, 1))
+	mock.ExpectExec("INSERT IGNORE INTO tags").WithArgs("go").WillReturnResult(sqlmock.NewResult(4, 1))
+	mock.ExpectExec("INSERT INTO snippet_tags").WithArgs(8, "go").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO snippet_revisions").WithArgs(2, sqlmock.AnyArg(), 8).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("SELECT id FROM snippet_revisions").WithArgs(8).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec("INSERT INTO snippet_revision_files").WithArgs(1, 8).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	m := &SnippetModel{DB: db}
+	id, err := m.Fork(5, 2, SnippetInput{Title: "Title", Content: "Content", Language: "go", Format: FormatPlain, Visibility: VisibilityPublic, Tags: []string{"go"}})
+	if err != nil {
+		t.Fatalf("error was not expected while forking: %s", err)
+	}
+	if id != 8 {
+		t.Errorf("the returned value of id is not correct: %d", id)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSnippetModel_BurnDeletesSnippet(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	columns := []string{"id", "user_id", "name", "slug", "title", "content", "language", "visibility", "created", "expires", "parent_id", "forks", "burn_after_reading", "password_hash", "encrypted", "filename", "format", "parent_slug"}
+	created := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FOR UPDATE").WithArgs(sqlmock.AnyArg(), 4).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(4, 1, "Alice", "abc", "Title", "secret", "plaintext", VisibilityUnlisted, created, nil, nil, 0, true, nil, false, "", FormatPlain, nil))
+	mock.ExpectQuery("SELECT (.+) FROM snippet_tags").WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"snippet_id", "name"}).AddRow(4, "credentials"))
+	mock.ExpectQuery("SELECT (.+) FROM snippet_files").WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"position", "filename", "language", "content"}))
+	mock.ExpectExec("DELETE FROM snippets").WithArgs(4).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	m := &SnippetModel{DB: db}
+	s, err := m.Burn(4)
+	if err != nil {
+		t.Fatalf("error was not expected while burning: %s", err)
+	}
+	if s.Content != "secret" || len(s.Tags) != 1 {
+		t.Errorf("unexpected snippet %+v", s)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSnippetModel_BurnAlreadyDeleted(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FOR UPDATE").WithArgs(sqlmock.AnyArg(), 4).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	m := &SnippetModel{DB: db}
+	_, err = m.Burn(4)
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("got %v; want ErrNoRecord", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSnippetModel_UpdateSetsPassword(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE snippets SET title").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE snippets SET password_hash").WithArgs(sqlmock.AnyArg(), 3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM snippet_tags").WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM snippet_files").WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO snippet_revisions").WithArgs(1, sqlmock.AnyArg(), 3).WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectQuery("SELECT id FROM snippet_revisions").WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectExec("INSERT INTO snippet_revision_files").WithArgs(2, 3).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	m := &SnippetModel{DB: db}
+	err = m.Update(3, 1, SnippetInput{Title: "Title", Content: "Content", Language: "go", Visibility: VisibilityPublic, Password: "open sesame"})
+	if err != nil {
+		t.Fatalf("error was not expected while updating: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSnippet_CheckPassword(t *testing.T) {
+	hashedPassword, err := hashPassword("open sesame")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Snippet{HashedPassword: []byte(hashedPassword.String)}
+	if !s.Protected() {
+		t.Error("snippet with a password is not protected")
+	}
+
+	if err := s.CheckPassword("open sesame"); err != nil {
+		t.Errorf("unexpected error for the right password: %v", err)
+	}
+	if err := s.CheckPassword("open barley"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("got %v; want ErrInvalidCredentials", err)
+	}
+}
+
+func TestSnippet_AllFiles(t *testing.T) {
+	s := &Snippet{Filename: "main.go", Content: "Main", Language: "go", Files: []*SnippetFile{
+		{Position: 1, Filename: "go.mod", Content: "Module", Language: "plaintext"},
+	}}
+
+	files := s.AllFiles()
+	if len(files) != 2 {
+		t.Fatalf("got %d files; want 2", len(files))
+	}
+	if files[0].Filename != "main.go" || files[0].Content != "Main" || files[1].Filename != "go.mod" {
+		t.Errorf("unexpected files %+v, %+v", files[0], files[1])
+	}
+
+	if f := s.File(1); f == nil || f.Filename != "go.mod" {
+		t.Errorf("got %+v for position 1; want go.mod", f)
+	}
+	if f := s.File(2); f != nil {
+		t.Errorf("got %+v for position 2; want nil", f)
+	}
+}
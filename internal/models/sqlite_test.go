@@ -0,0 +1,368 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/liviu-moraru/snippetbox/internal/migrations"
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"time"
+)
+
+// newSQLiteDB opens an in-memory SQLite database, migrated to the latest
+// version, with a single user whose ID is 1.
+func newSQLiteDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:?_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: opens a different database.
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.New(db, SQLite.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = migrator.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := &UserModel{DB: db, Dialect: SQLite}
+	err = users.Insert("Alice Jones", "alice@example.com", "pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestSQLite_SnippetModel(t *testing.T) {
+	db := newSQLiteDB(t)
+	m := &SnippetModel{DB: db, Dialect: SQLite}
+
+	input := SnippetInput{
+		Title:      "An old silent pond",
+		Content:    "An old silent pond...",
+		Language:   "plaintext",
+		Format:     FormatPlain,
+		Visibility: VisibilityPublic,
+		Expires:    sql.NullTime{Time: time.Now().Add(24 * time.Hour), Valid: true},
+		Tags:       []string{"haiku", "poetry"},
+		Filename:   "pond.txt",
+		Files:      []SnippetFile{{Filename: "frog.txt", Language: "plaintext", Content: "A frog jumps"}},
+	}
+
+	id, err := m.Insert(1, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := m.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Title.String != input.Title || s.Filename != input.Filename || s.Author != "Alice Jones" {
+		t.Errorf("unexpected snippet %+v", s)
+	}
+	if len(s.Tags) != 2 || s.Tags[0] != "haiku" || s.Tags[1] != "poetry" {
+		t.Errorf("unexpected tags %v", s.Tags)
+	}
+	if len(s.Files) != 1 || s.Files[0].Position != 1 || s.Files[0].Content != "A frog jumps" {
+		t.Errorf("unexpected files %+v", s.Files)
+	}
+
+	found, err := m.GetBySlug(s.Slug, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != id {
+		t.Errorf("got snippet %d by slug; want %d", found.ID, id)
+	}
+
+	input.Title = "Over the wintry forest"
+	input.Tags = []string{"haiku"}
+	input.Files = nil
+	err = m.Update(id, 1, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = m.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Title.String != input.Title || len(s.Tags) != 1 || len(s.Files) != 0 {
+		t.Errorf("unexpected snippet after update %+v", s)
+	}
+
+	snippets, metadata, err := m.Search("wintry", SnippetFilter{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snippets) != 1 || metadata.TotalRecords != 1 {
+		t.Errorf("got %d snippets searching for wintry; want 1", len(snippets))
+	}
+
+	snippets, _, err = m.Search("autumn", SnippetFilter{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snippets) != 0 {
+		t.Errorf("got %d snippets searching for autumn; want 0", len(snippets))
+	}
+
+	snippets, _, err = m.List(SnippetFilter{Page: 1, PageSize: 10, Tag: "haiku", ExpiringWithin: 48 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snippets) != 1 {
+		t.Errorf("got %d snippets tagged haiku; want 1", len(snippets))
+	}
+
+	// Revisions record who made them, which isn't always the owner.
+	users := &UserModel{DB: db, Dialect: SQLite}
+	err = users.Insert("Bob Smith", "bob@example.com", "pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revisions := &SnippetRevisionModel{DB: db}
+	err = revisions.Restore(id, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := revisions.List(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 || history[0].UserID != 2 || history[0].Author != "Bob Smith" || history[1].UserID != 1 {
+		t.Errorf("unexpected revisions %+v", history)
+	}
+
+	s, err = m.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Title.String != "An old silent pond" {
+		t.Errorf("got title %q after restoring the first revision", s.Title.String)
+	}
+	// The extra files, removed by the update, are restored too.
+	if s.Filename != "pond.txt" || len(s.Files) != 1 || s.Files[0].Filename != "frog.txt" {
+		t.Errorf("got files %q and %+v after restoring the first revision", s.Filename, s.Files)
+	}
+
+	revision, err := revisions.Get(id, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revision.Filename != "pond.txt" || len(revision.Files) != 1 || revision.Files[0].Content != "A frog jumps" {
+		t.Errorf("unexpected files in the first revision: %q and %+v", revision.Filename, revision.Files)
+	}
+
+	err = revisions.Restore(id, 10, 1)
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("got error %v restoring a missing revision; want ErrNoRecord", err)
+	}
+
+	err = m.Delete(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Get(id)
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("got error %v after delete; want ErrNoRecord", err)
+	}
+}
+
+func TestSQLite_SnippetModelExpired(t *testing.T) {
+	db := newSQLiteDB(t)
+	m := &SnippetModel{DB: db, Dialect: SQLite}
+
+	id, err := m.Insert(1, SnippetInput{
+		Title:      "Expired",
+		Content:    "Content",
+		Language:   "plaintext",
+		Format:     FormatPlain,
+		Visibility: VisibilityPublic,
+		Expires:    sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Get(id)
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("got error %v for an expired snippet; want ErrNoRecord", err)
+	}
+}
+
+func TestSQLite_SnippetModelBurn(t *testing.T) {
+	db := newSQLiteDB(t)
+	m := &SnippetModel{DB: db, Dialect: SQLite}
+
+	id, err := m.Insert(1, SnippetInput{
+		Title:            "Secret",
+		Content:          "Content",
+		Language:         "plaintext",
+		Format:           FormatPlain,
+		Visibility:       VisibilityUnlisted,
+		BurnAfterReading: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := m.Burn(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Content != "Content" {
+		t.Errorf("got content %q", s.Content)
+	}
+
+	_, err = m.Burn(id)
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("got error %v burning twice; want ErrNoRecord", err)
+	}
+}
+
+func TestSQLite_TagModel(t *testing.T) {
+	db := newSQLiteDB(t)
+	snippets := &SnippetModel{DB: db, Dialect: SQLite}
+	m := &TagModel{DB: db}
+
+	// Only the tag of the public snippet may be seen.
+	inputs := []SnippetInput{
+		{Visibility: VisibilityPublic, Tags: []string{"haiku"}},
+		{Visibility: VisibilityPrivate, Tags: []string{"private-tag"}},
+		{Visibility: VisibilityUnlisted, Tags: []string{"unlisted-tag"}},
+		{Visibility: VisibilityPublic, Tags: []string{"burn-tag"}, BurnAfterReading: true},
+		{Visibility: VisibilityPublic, Tags: []string{"password-tag"}, Password: "pa$$word"},
+		{Visibility: VisibilityPublic, Tags: []string{"expired-tag"}, Expires: sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}},
+	}
+	for _, input := range inputs {
+		input.Title = "Title"
+		input.Content = "Content"
+		input.Language = "plaintext"
+		input.Format = FormatPlain
+
+		_, err := snippets.Insert(1, input)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tags, err := m.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Name != "haiku" || tags[0].Snippets != 1 {
+		t.Errorf("unexpected tags %+v", tags)
+	}
+
+	for _, name := range []string{"haiku", "private-tag", "unlisted-tag", "burn-tag", "password-tag", "expired-tag", "unknown"} {
+		exists, err := m.Exists(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := name == "haiku"; exists != want {
+			t.Errorf("got %q exists %t; want %t", name, exists, want)
+		}
+	}
+}
+
+func TestSQLite_IsDuplicate(t *testing.T) {
+	db := newSQLiteDB(t)
+
+	_, err := db.Exec(`INSERT INTO snippets (user_id, slug, title, content, created) VALUES (1, 'abc', 'a', 'a', ?), (1, 'abc', 'b', 'b', ?)`, now(), now())
+	if !SQLite.isDuplicate(err, "snippets", "slug") {
+		t.Errorf("got error %v; want a duplicate slug", err)
+	}
+	if SQLite.isDuplicate(err, "users", "email") {
+		t.Errorf("error %v reported as a duplicate email", err)
+	}
+}
+
+func TestSQLite_UserModel(t *testing.T) {
+	db := newSQLiteDB(t)
+	m := &UserModel{DB: db, Dialect: SQLite}
+
+	err := m.Insert("Alice Jones", "alice@example.com", "pa$$word")
+	if !errors.Is(err, ErrDuplicateEmail) {
+		t.Errorf("got error %v; want ErrDuplicateEmail", err)
+	}
+
+	u, err := m.Authenticate("alice@example.com", "pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != 1 {
+		t.Errorf("got user %d; want 1", u.ID)
+	}
+
+	_, err = m.Authenticate("alice@example.com", "wrong")
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("got error %v; want ErrInvalidCredentials", err)
+	}
+
+	exists, err := m.Exists(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Error("user 1 should exist")
+	}
+}
+
+func TestSQLite_SessionStore(t *testing.T) {
+	db := newSQLiteDB(t)
+	s := NewSessionStore(db, 0)
+
+	err := s.Commit("token", []byte("data"), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Commit("token", []byte("updated"), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Commit("expired", []byte("data"), time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, found, err := s.Find("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || string(b) != "updated" {
+		t.Errorf("got %q, %t; want the updated data", b, found)
+	}
+
+	_, found, err = s.Find("expired")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Error("an expired session was found")
+	}
+
+	err = s.Delete("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, found, err = s.Find("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Error("a deleted session was found")
+	}
+}
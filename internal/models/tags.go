@@ -0,0 +1,157 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// Tag Define a Tag type to hold a tag name, together with the number of
+// public snippets using it.
+type Tag struct {
+	Name     string
+	Snippets int
+}
+
+// TagModelInterface Define a TagModelInterface type, so that the tag pages can
+// be tested with a fake implementation.
+type TagModelInterface interface {
+	List() ([]*Tag, error)
+	Exists(name string) (bool, error)
+}
+
+// TagModel Define a TagModel type which wraps a database connection pool.
+type TagModel struct {
+	DB *sql.DB
+}
+
+// List returns the tags used by at least one public, non-expired snippet,
+// ordered by name.
+func (m *TagModel) List() ([]*Tag, error) {
+	stmt := `SELECT t.name, COUNT(*) FROM tags t
+	INNER JOIN snippet_tags st ON st.tag_id = t.id
+	INNER JOIN snippets s ON s.id = st.snippet_id
+	WHERE ` + notExpired + ` AND ` + listed + `
+	GROUP BY t.name ORDER BY t.name`
+
+	rows, err := m.DB.Query(stmt, now())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var tags []*Tag
+	for rows.Next() {
+		t := &Tag{}
+		err := rows.Scan(&t.Name, &t.Snippets)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// Exists reports whether a tag is used by at least one snippet which List
+// counts. The tags of hidden snippets are treated as if they didn't exist, so
+// that their names aren't given away.
+func (m *TagModel) Exists(name string) (bool, error) {
+	var exists bool
+
+	stmt := `SELECT EXISTS(SELECT true FROM tags t
+	INNER JOIN snippet_tags st ON st.tag_id = t.id
+	INNER JOIN snippets s ON s.id = st.snippet_id
+	WHERE ` + notExpired + ` AND ` + listed + ` AND t.name = ?)`
+
+	err := m.DB.QueryRow(stmt, now(), name).Scan(&exists)
+	return exists, err
+}
+
+// insertTags attaches tags to a snippet, creating the tags which don't exist
+// yet. Like insertRevision, it runs inside the transaction saving the
+// snippet. The names must already be normalised and unique.
+func insertTags(tx *sql.Tx, d Dialect, snippetID int, tags []string) error {
+	for _, name := range tags {
+		_, err := tx.Exec(d.insertIgnore(`INSERT INTO tags (name) VALUES (?)`), name)
+		if err != nil {
+			return err
+		}
+
+		stmt := `INSERT INTO snippet_tags (snippet_id, tag_id)
+		SELECT ?, id FROM tags WHERE name = ?`
+
+		_, err = tx.Exec(stmt, snippetID, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setTags replaces all the tags of a snippet. Tags which are no longer used
+// by any snippet are kept; they simply stop showing up in the listings.
+func setTags(tx *sql.Tx, d Dialect, snippetID int, tags []string) error {
+	_, err := tx.Exec(`DELETE FROM snippet_tags WHERE snippet_id = ?`, snippetID)
+	if err != nil {
+		return err
+	}
+
+	return insertTags(tx, d, snippetID, tags)
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// loadTags fills in the Tags field of the snippets with a single query, so
+// that listings don't need one query per snippet.
+func loadTags(db querier, snippets ...*Snippet) error {
+	if len(snippets) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*Snippet, len(snippets))
+	placeholders := make([]string, 0, len(snippets))
+	args := make([]any, 0, len(snippets))
+
+	for _, s := range snippets {
+		byID[s.ID] = s
+		placeholders = append(placeholders, "?")
+		args = append(args, s.ID)
+	}
+
+	stmt := `SELECT st.snippet_id, t.name FROM snippet_tags st
+	INNER JOIN tags t ON t.id = st.tag_id
+	WHERE st.snippet_id IN (` + strings.Join(placeholders, ", ") + `)
+	ORDER BY t.name`
+
+	rows, err := db.Query(stmt, args...)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var snippetID int
+		var name string
+
+		err := rows.Scan(&snippetID, &name)
+		if err != nil {
+			return err
+		}
+
+		if s, ok := byID[snippetID]; ok {
+			s.Tags = append(s.Tags, name)
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// Token Define a Token type to hold the details of a personal API token. The
+// plain-text token is only ever known when it is created; the database only
+// stores its SHA-256 hash.
+type Token struct {
+	ID       int
+	UserID   int
+	Name     string
+	Created  time.Time
+	LastUsed sql.NullTime
+}
+
+// TokenModelInterface Define a TokenModelInterface type, so that the handlers
+// can be tested with a fake implementation.
+type TokenModelInterface interface {
+	Insert(userID int, name string) (string, error)
+	List(userID int) ([]*Token, error)
+	Delete(id int, userID int) error
+	GetUser(plaintext string) (*User, error)
+}
+
+// TokenModel Define a TokenModel type which wraps a database connection pool.
+type TokenModel struct {
+	DB *sql.DB
+}
+
+// hashToken returns the hex encoded SHA-256 hash of a plain-text token. A fast
+// hash is fine here (unlike passwords) because tokens are long random values.
+func hashToken(plaintext string) string {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(hash[:])
+}
+
+// Insert creates a new named token for a user and returns its plain-text
+// value, which can't be recovered later.
+func (m *TokenModel) Insert(userID int, name string) (string, error) {
+	// Use 32 bytes from the operating system's CSPRNG, encoded so that the
+	// token is safe to use in an HTTP header.
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	plaintext := base64.RawURLEncoding.EncodeToString(randomBytes)
+
+	stmt := `INSERT INTO tokens (user_id, name, hash, created)
+	VALUES(?, ?, ?, ?)`
+
+	_, err = m.DB.Exec(stmt, userID, name, hashToken(plaintext), now())
+	if err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+// List returns all the tokens belonging to a user, newest first.
+func (m *TokenModel) List(userID int) ([]*Token, error) {
+	stmt := `SELECT id, user_id, name, created, last_used FROM tokens
+	WHERE user_id = ? ORDER BY id DESC`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var tokens []*Token
+	for rows.Next() {
+		t := &Token{}
+		err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Created, &t.LastUsed)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Delete revokes a token. The user ID is part of the query so that users can
+// only revoke their own tokens; otherwise ErrNoRecord is returned.
+func (m *TokenModel) Delete(id int, userID int) error {
+	stmt := `DELETE FROM tokens WHERE id = ? AND user_id = ?`
+
+	result, err := m.DB.Exec(stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// GetUser returns the active user that owns a plain-text token, and records
+// when the token was last used. If the token doesn't exist (or its owner has
+// been disabled) ErrNoRecord is returned.
+func (m *TokenModel) GetUser(plaintext string) (*User, error) {
+	hash := hashToken(plaintext)
+
+	stmt := `SELECT u.id, u.name, u.email, u.created, u.active
+	FROM users u INNER JOIN tokens t ON t.user_id = u.id
+	WHERE t.hash = ? AND u.active = TRUE`
+
+	u := &User{}
+
+	err := m.DB.QueryRow(stmt, hash).Scan(&u.ID, &u.Name, &u.Email, &u.Created, &u.Active)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	_, err = m.DB.Exec(`UPDATE tokens SET last_used = ? WHERE hash = ?`, now(), hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
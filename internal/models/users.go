@@ -3,9 +3,7 @@ package models
 import (
 	"database/sql"
 	"errors"
-	"github.com/go-sql-driver/mysql"
 	"golang.org/x/crypto/bcrypt"
-	"strings"
 	"time"
 )
 
@@ -17,11 +15,24 @@ type User struct {
 	Email          string
 	HashedPassword []byte
 	Created        time.Time
+	Active         bool
 }
 
-// UserModel Define a new UserModel type which wraps a database connection pool.
+// UserModelInterface Define a UserModelInterface type, so that the handlers
+// don't depend on a particular database, and can be tested with a fake
+// implementation.
+type UserModelInterface interface {
+	Insert(name string, email string, password string) error
+	Authenticate(email string, password string) (User, error)
+	Get(id int) (*User, error)
+}
+
+// UserModel Define a new UserModel type which wraps a database connection
+// pool, and implements UserModelInterface for the database of the given
+// dialect.
 type UserModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Dialect Dialect
 }
 
 // Insert We'll use the Insert method to add a new record to the "users" table.
@@ -33,17 +44,15 @@ func (m *UserModel) Insert(name string, email string, password string) error {
 	}
 
 	stmt := `INSERT INTO users (name, email, hashed_password, created)
-	VALUES(?, ?, ?, UTC_TIMESTAMP())`
+	VALUES(?, ?, ?, ?)`
 
 	// Use the Exec() method to insert the user details and hashed password
-	// into the users table.
-	_, err = m.DB.Exec(stmt, name, email, string(hashedPassword))
+	// into the users table. If the email address is already taken, the
+	// UNIQUE constraint on the email column rejects the row.
+	_, err = m.DB.Exec(stmt, name, email, string(hashedPassword), now())
 	if err != nil {
-		var mySQLError *mysql.MySQLError
-		if errors.As(err, &mySQLError) {
-			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_email") {
-				return ErrDuplicateEmail
-			}
+		if m.Dialect.isDuplicate(err, "users", "email") {
+			return ErrDuplicateEmail
 		}
 		return err
 	}
@@ -54,8 +63,9 @@ func (m *UserModel) Insert(name string, email string, password string) error {
 // the provided email address and password. This will return the relevant
 // user ID if they do.
 func (m *UserModel) Authenticate(email string, password string) (User, error) {
+	// Disabled accounts are treated exactly as if they don't exist.
 	stmt := `SELECT id, name, hashed_password FROM users
-				WHERE email = ?`
+				WHERE email = ? AND active = TRUE`
 	u := User{}
 	err := m.DB.QueryRow(stmt, email).Scan(&u.ID, &u.Name, &u.HashedPassword)
 	if err != nil {
@@ -79,7 +89,33 @@ func (m *UserModel) Authenticate(email string, password string) (User, error) {
 	return u, nil
 }
 
-// Exists We'll use the Exists method to check if a user exists with a specific ID.
+// Get returns the active user with a specific ID. If the user has been
+// deleted or disabled, ErrNoRecord is returned.
+func (m *UserModel) Get(id int) (*User, error) {
+	stmt := `SELECT id, name, email, created, active FROM users
+	WHERE id = ? AND active = TRUE`
+
+	u := &User{}
+
+	err := m.DB.QueryRow(stmt, id).Scan(&u.ID, &u.Name, &u.Email, &u.Created, &u.Active)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// Exists We'll use the Exists method to check if an active user exists with a
+// specific ID. It isn't part of UserModelInterface: the authenticate
+// middleware needs the user itself, which it loads with Get.
 func (m *UserModel) Exists(id int) (bool, error) {
-	return false, nil
+	var exists bool
+
+	stmt := "SELECT EXISTS(SELECT true FROM users WHERE id = ? AND active = TRUE)"
+
+	err := m.DB.QueryRow(stmt, id).Scan(&exists)
+	return exists, err
 }
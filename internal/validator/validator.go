@@ -3,6 +3,7 @@ package validator
 import (
 	"regexp"
 	"strings"
+	"time"
 	"unicode/utf8"
 )
 
@@ -86,6 +87,22 @@ func (v *Validator) PermittedInt(value int, permittedValues ...int) bool {
 	return false
 }
 
+// After returns true if a time is strictly after the given limit.
+func (v *Validator) After(value, limit time.Time) bool {
+	return value.After(limit)
+}
+
+// NotAfter returns true if a time is the same as, or before, the given limit.
+func (v *Validator) NotAfter(value, limit time.Time) bool {
+	return !value.After(limit)
+}
+
+// Between returns true if a time is strictly after min, and no later than
+// max.
+func (v *Validator) Between(value, min, max time.Time) bool {
+	return v.After(value, min) && v.NotAfter(value, max)
+}
+
 func Permitted[T comparable](value T, permittedValues ...T) bool {
 	for _, i := range permittedValues {
 		if value == i {
@@ -5,6 +5,7 @@ import (
 	"github.com/liviu-moraru/snippetbox/internal/validator"
 	"golang.org/x/crypto/bcrypt"
 	"testing"
+	"time"
 )
 
 func TestValidator_Permitted(t *testing.T) {
@@ -50,3 +51,30 @@ func TestPasswordHashFunction(t *testing.T) {
 		t.Fatal("Comparison error")
 	}
 }
+
+func TestValidator_Between(t *testing.T) {
+	v := validator.Validator{}
+
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	max := now.AddDate(1, 0, 0)
+
+	tests := []struct {
+		name  string
+		value time.Time
+		want  bool
+	}{
+		{"In the past", now.Add(-time.Minute), false},
+		{"Same as min", now, false},
+		{"In range", now.Add(time.Hour), true},
+		{"Same as max", max, true},
+		{"After max", max.Add(time.Second), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := v.Between(tt.value, now, max); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,4 +5,268 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+
+// End-to-end encrypted snippets. The content is encrypted with AES-GCM in the
+// browser, and the key is kept in the URL fragment, which browsers never send
+// to the server. Encrypted content is "e2e:v1:" followed by the IV and the
+// ciphertext, base64url encoded.
+var encryptedPrefix = "e2e:v1:";
+var ivLength = 12;
+
+function toBase64URL(bytes) {
+	var binary = "";
+	for (var i = 0; i < bytes.length; i++) {
+		binary += String.fromCharCode(bytes[i]);
+	}
+	return btoa(binary).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+function fromBase64URL(text) {
+	text = text.replace(/-/g, "+").replace(/_/g, "/");
+	while (text.length % 4) {
+		text += "=";
+	}
+	var binary = atob(text);
+	var bytes = new Uint8Array(binary.length);
+	for (var i = 0; i < binary.length; i++) {
+		bytes[i] = binary.charCodeAt(i);
+	}
+	return bytes;
+}
+
+// fragmentKey returns the encoded key held in the URL fragment, if any.
+function fragmentKey() {
+	return window.location.hash.slice(1);
+}
+
+function importKey(encodedKey) {
+	return crypto.subtle.importKey("raw", fromBase64URL(encodedKey), "AES-GCM", false, ["encrypt", "decrypt"]);
+}
+
+// newKey resolves to a new random key, together with its encoded form.
+function newKey() {
+	return crypto.subtle.generateKey({name: "AES-GCM", length: 256}, true, ["encrypt", "decrypt"]).then(function (key) {
+		return crypto.subtle.exportKey("raw", key).then(function (raw) {
+			return {key: key, encoded: toBase64URL(new Uint8Array(raw))};
+		});
+	});
+}
+
+// fragmentOrNewKey reuses the key from the URL fragment, so that editing an
+// encrypted snippet doesn't break the links already shared, or makes a new
+// one.
+function fragmentOrNewKey() {
+	var encoded = fragmentKey();
+	if (!encoded) {
+		return newKey();
+	}
+	return importKey(encoded).then(function (key) {
+		return {key: key, encoded: encoded};
+	});
+}
+
+function encryptText(key, text) {
+	var iv = crypto.getRandomValues(new Uint8Array(ivLength));
+	return crypto.subtle.encrypt({name: "AES-GCM", iv: iv}, key, new TextEncoder().encode(text)).then(function (ciphertext) {
+		var bytes = new Uint8Array(iv.length + ciphertext.byteLength);
+		bytes.set(iv);
+		bytes.set(new Uint8Array(ciphertext), iv.length);
+		return encryptedPrefix + toBase64URL(bytes);
+	});
+}
+
+function decryptText(key, content) {
+	var bytes = fromBase64URL(content.slice(encryptedPrefix.length));
+	return crypto.subtle.decrypt({name: "AES-GCM", iv: bytes.slice(0, ivLength)}, key, bytes.slice(ivLength)).then(function (plaintext) {
+		return new TextDecoder().decode(plaintext);
+	});
+}
+
+function isEncrypted(content) {
+	return content.indexOf(encryptedPrefix) === 0;
+}
+
+// Pass the fragment on to the links and forms which need the key. Only the
+// browser ever sees it.
+if (window.location.hash) {
+	var fragmentLinks = document.querySelectorAll("a[data-keep-fragment]");
+	for (var i = 0; i < fragmentLinks.length; i++) {
+		fragmentLinks[i].href += window.location.hash;
+	}
+
+	var fragmentForms = document.querySelectorAll("form[data-keep-fragment]");
+	for (var i = 0; i < fragmentForms.length; i++) {
+		fragmentForms[i].setAttribute("action", fragmentForms[i].getAttribute("action") + window.location.hash);
+	}
+}
+
+// Decrypt the encrypted snippets shown on the page. The plain text is only
+// ever set as text, never as HTML.
+function decryptSnippet(pre) {
+	var code = pre.querySelector("code");
+
+	if (!fragmentKey()) {
+		code.textContent = "The key is missing from the link, so this snippet can't be decrypted.";
+		return;
+	}
+
+	importKey(fragmentKey()).then(function (key) {
+		return decryptText(key, pre.getAttribute("data-ciphertext"));
+	}).then(function (plaintext) {
+		code.textContent = plaintext;
+	}).catch(function () {
+		code.textContent = "This snippet couldn't be decrypted. Check that the link is complete.";
+	});
+}
+
+var encryptedSnippets = document.querySelectorAll("pre[data-ciphertext]");
+for (var i = 0; i < encryptedSnippets.length; i++) {
+	decryptSnippet(encryptedSnippets[i]);
+}
+
+// Encrypt the content of the snippet form before it is sent. The key is added
+// to the fragment of the form action: the server redirects to the snippet
+// without a fragment, so the browser carries this one over to the snippet
+// URL.
+function setupEncryptedForm(checkbox) {
+	var form = checkbox.form;
+	var content = form.elements["content"];
+
+	// Content sent back by the server, when editing or after a validation
+	// error, is decrypted again so that it can be changed.
+	if (isEncrypted(content.value) && fragmentKey()) {
+		importKey(fragmentKey()).then(function (key) {
+			return decryptText(key, content.value);
+		}).then(function (plaintext) {
+			content.value = plaintext;
+		}).catch(function () {
+		});
+	}
+
+	form.addEventListener("submit", function (event) {
+		if (!checkbox.checked || isEncrypted(content.value)) {
+			return;
+		}
+		event.preventDefault();
+
+		fragmentOrNewKey().then(function (k) {
+			return encryptText(k.key, content.value).then(function (ciphertext) {
+				content.value = ciphertext;
+				form.setAttribute("action", form.getAttribute("action").split("#")[0] + "#" + k.encoded);
+				form.submit();
+			});
+		}).catch(function () {
+			alert("Your browser couldn't encrypt this snippet.");
+		});
+	});
+}
+
+var encryptCheckboxes = document.querySelectorAll('input[name="encrypted"]');
+for (var i = 0; i < encryptCheckboxes.length; i++) {
+	setupEncryptedForm(encryptCheckboxes[i]);
+}
+
+// Add and remove the extra files of the snippet form. The fields of each file
+// are named like files[0].filename, so they are numbered again after every
+// change, for the server to decode them in order.
+function numberFiles(container) {
+	var files = container.querySelectorAll("fieldset.file");
+	for (var i = 0; i < files.length; i++) {
+		var fields = files[i].querySelectorAll("[data-file-field]");
+		for (var j = 0; j < fields.length; j++) {
+			fields[j].name = "files[" + i + "]." + fields[j].getAttribute("data-file-field");
+		}
+	}
+}
+
+function setupRemoveFile(button) {
+	button.hidden = false;
+	button.addEventListener("click", function () {
+		var container = button.closest("div.files");
+		button.closest("fieldset.file").remove();
+		numberFiles(container);
+	});
+}
+
+var addFileButtons = document.querySelectorAll("button[data-add-file]");
+for (var i = 0; i < addFileButtons.length; i++) {
+	(function (button) {
+		var container = button.form.querySelector("div.files");
+		var template = button.form.querySelector("#file-template");
+
+		button.hidden = false;
+		button.addEventListener("click", function () {
+			var file = template.content.firstElementChild.cloneNode(true);
+			setupRemoveFile(file.querySelector("button[data-remove-file]"));
+			container.appendChild(file);
+			numberFiles(container);
+			file.querySelector("input").focus();
+		});
+	})(addFileButtons[i]);
+}
+
+var removeFileButtons = document.querySelectorAll("div.files button[data-remove-file]");
+for (var i = 0; i < removeFileButtons.length; i++) {
+	setupRemoveFile(removeFileButtons[i]);
+}
+
+// The preview tab of the snippet form. The content is rendered by the server,
+// which sanitizes it, so the response can be inserted as HTML. Encrypted
+// snippets aren't previewed, as that would send the plain text to the server.
+function setupPreview(tabs) {
+	var form = tabs.closest("form");
+	var content = form.elements["content"];
+	var preview = form.querySelector("div[data-preview]");
+	var write = tabs.querySelector('[data-tab="write"]');
+	var show = tabs.querySelector('[data-tab="preview"]');
+
+	function select(tab) {
+		write.classList.toggle("live", tab === write);
+		show.classList.toggle("live", tab === show);
+		content.hidden = tab !== write;
+		preview.hidden = tab !== show;
+	}
+
+	write.addEventListener("click", function () {
+		select(write);
+	});
+
+	show.addEventListener("click", function () {
+		var encrypted = form.elements["encrypted"];
+		if (encrypted && encrypted.checked) {
+			preview.textContent = "Encrypted snippets can't be previewed.";
+			select(show);
+			return;
+		}
+
+		fetch("/snippet/preview", {
+			method: "POST",
+			headers: {"Content-Type": "application/x-www-form-urlencoded"},
+			body: new URLSearchParams({
+				csrf_token: form.elements["csrf_token"].value,
+				content: content.value,
+				language: form.elements["language"].value,
+				format: form.elements["format"].value
+			})
+		}).then(function (response) {
+			if (!response.ok) {
+				throw new Error(response.statusText);
+			}
+			return response.text();
+		}).then(function (html) {
+			preview.innerHTML = html;
+			select(show);
+		}).catch(function () {
+			preview.textContent = "The preview couldn't be loaded.";
+			select(show);
+		});
+	});
+
+	tabs.hidden = false;
+}
+
+var previewTabs = document.querySelectorAll("div[data-preview-tabs]");
+for (var i = 0; i < previewTabs.length; i++) {
+	setupPreview(previewTabs[i]);
+}